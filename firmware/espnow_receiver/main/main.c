@@ -11,6 +11,7 @@
 #include "nvs_flash.h"
 #include "protocol.h"
 #include <assert.h>
+#include <inttypes.h>
 #include <stdlib.h>
 
 #define ESPNOW_WIFI_MODE WIFI_MODE_AP
@@ -25,6 +26,7 @@ static uint8_t data_buffer_index = 0;
 
 typedef struct {
     uint8_t mac_addr[ESP_NOW_ETH_ALEN];
+    int rssi;
     uint8_t *data;
     int data_len;
 } event_recv_cb_t;
@@ -76,6 +78,7 @@ static void test_espnow_recv_cb(const esp_now_recv_info_t *recv_info, const uint
 
     // TODO: add check dest_addr if needed
     memcpy(recv_cb.mac_addr, mac_addr, ESP_NOW_ETH_ALEN);
+    recv_cb.rssi = recv_info->rx_ctrl != NULL ? recv_info->rx_ctrl->rssi : 0;
     recv_cb.data = get_static_buffer(len);
     if (recv_cb.data == NULL) {
         ESP_LOGE(TAG, "get_static_buffer receive data fail");
@@ -88,7 +91,7 @@ static void test_espnow_recv_cb(const esp_now_recv_info_t *recv_info, const uint
     }
 }
 
-static void data_parse(const uint8_t *data, int len) {
+static void data_parse(const uint8_t *mac_addr, int rssi, const uint8_t *data, int len) {
     static const char *TAG_DATA = "qf8mzr";
     test_espnow_data_t *recv_data = (test_espnow_data_t *)data;
 
@@ -109,8 +112,10 @@ static void data_parse(const uint8_t *data, int len) {
         return;
     }
 
-    ESP_LOGI(TAG_DATA, "%d,%d,%d,%d", recv_data->payload.temperature, recv_data->payload.humidity,
-             unpack_pressure(recv_data->payload.pressure), recv_data->payload.voltage);
+    // the server reads the sender from the mac and rssi fields, see packet.EncodeSerialLine
+    ESP_LOGI(TAG_DATA, "%d,%d,%" PRIu32 ",%d mac=" MACSTR " rssi=%d", recv_data->payload.temperature,
+             recv_data->payload.humidity, unpack_pressure(recv_data->payload.pressure), recv_data->payload.voltage,
+             MAC2STR(mac_addr), rssi);
 }
 
 static void test_espnow_task(void *pvParameter) {
@@ -131,7 +136,7 @@ static void test_espnow_task(void *pvParameter) {
 
         ESP_LOGD(TAG, "receive data from " MACSTR ", len: %d", MAC2STR(recv_cb.mac_addr), recv_cb.data_len);
         if (recv_cb.data) {
-            data_parse(recv_cb.data, recv_cb.data_len);
+            data_parse(recv_cb.mac_addr, recv_cb.rssi, recv_cb.data, recv_cb.data_len);
         }
     }
 }
@@ -0,0 +1,100 @@
+#pragma once
+
+#ifndef UDP_FRAME_H
+#define UDP_FRAME_H
+
+#include <Arduino.h>
+#include <esp_crc.h>
+#include <mbedtls/md.h>
+#include "SensorData.h"
+
+// Framed UDP packet, see EncodeUDPFrame in the server:
+// "TS", version, id length, device id, sequence, ESP-NOW payload, CRC16 and
+// optionally the boot epoch and a truncated HMAC-SHA256 tag of everything
+// before it.
+class UDPFrame
+{
+    static constexpr uint8_t MAGIC[2] = {'T', 'S'};
+    static constexpr uint8_t VERSION = 1;
+    static constexpr size_t PAYLOAD_SIZE = 9;
+
+public:
+    static constexpr size_t MAX_DEVICE_ID_SIZE = 32;
+    static constexpr size_t TAG_SIZE = 8;
+    static constexpr size_t MAX_SIZE = 4 + MAX_DEVICE_ID_SIZE + 4 + PAYLOAD_SIZE + 2 + 4 + TAG_SIZE;
+
+    /**
+     * @brief Encodes a reading into a frame
+     * @param deviceID Printable ASCII id, up to MAX_DEVICE_ID_SIZE bytes
+     * @param sequence Reading counter, repeats of one reading share it
+     * @param data Sensor reading, pressure in Pa and voltage in mV
+     * @param buffer Output of at least MAX_SIZE bytes
+     * @param key Shared key of the device, nullptr sends the frame unsigned
+     * @param keySize Key size in bytes
+     * @param epoch Boot counter kept in flash, the sequence restarts with it
+     * @return Frame size, 0 if the id does not fit or signing failed
+     */
+    [[nodiscard]] static size_t encode(const char *deviceID, uint32_t sequence, const SensorData &data, uint8_t *buffer,
+                                       const uint8_t *key = nullptr, size_t keySize = 0, uint32_t epoch = 0)
+    {
+        size_t idSize = strlen(deviceID);
+        if (idSize == 0 || idSize > MAX_DEVICE_ID_SIZE)
+        {
+            return 0;
+        }
+
+        size_t n = 0;
+        buffer[n++] = MAGIC[0];
+        buffer[n++] = MAGIC[1];
+        buffer[n++] = VERSION;
+        buffer[n++] = idSize;
+        memcpy(buffer + n, deviceID, idSize);
+        n += idSize;
+
+        n = putUint32(buffer, n, sequence);
+        n = putUint16(buffer, n, static_cast<uint16_t>(static_cast<int16_t>(lroundf(data.temperature * 100))));
+        n = putUint16(buffer, n, static_cast<uint16_t>(lroundf(data.humidity * 100)));
+
+        uint32_t pressure = lroundf(data.pressure);
+        buffer[n++] = (pressure >> 16) & 0xFF;
+        buffer[n++] = (pressure >> 8) & 0xFF;
+        buffer[n++] = pressure & 0xFF;
+
+        n = putUint16(buffer, n, static_cast<uint16_t>(lroundf(data.voltage)));
+
+        n = putUint16(buffer, n, esp_crc16_le(UINT16_MAX, buffer, n));
+
+        if (key == nullptr)
+        {
+            return n;
+        }
+
+        n = putUint32(buffer, n, epoch);
+
+        uint8_t mac[32];
+        if (mbedtls_md_hmac(mbedtls_md_info_from_type(MBEDTLS_MD_SHA256), key, keySize, buffer, n, mac) != 0)
+        {
+            return 0;
+        }
+
+        memcpy(buffer + n, mac, TAG_SIZE);
+
+        return n + TAG_SIZE;
+    }
+
+private:
+    static size_t putUint16(uint8_t *buffer, size_t n, uint16_t v)
+    {
+        buffer[n++] = v & 0xFF;
+        buffer[n++] = v >> 8;
+        return n;
+    }
+
+    static size_t putUint32(uint8_t *buffer, size_t n, uint32_t v)
+    {
+        n = putUint16(buffer, n, v & 0xFFFF);
+        return putUint16(buffer, n, v >> 16);
+    }
+};
+
+#endif
@@ -1,8 +1,10 @@
+#include <Preferences.h>
 #include "debug.h"
 #include "secrets.h"
 #include "SensorData.h"
 #include "BME280Handler.h"
 #include "UDPBroadcast.h"
+#include "UDPFrame.h"
 #include "WiFiHandler.h"
 #include "CriticalError.h"
 
@@ -14,6 +16,29 @@ constexpr uint8_t BME_PWR = 4;     // GPIO 4 (HIGH)
 constexpr uint8_t BAT_ACC = 3;
 constexpr float VOLTAGE_DIVIDER = 1.667; // 1M + 1.5M
 
+// Survives deep sleep, counts readings so the server can spot lost ones.
+RTC_DATA_ATTR uint32_t sequence = 0;
+
+#ifdef UDP_AUTH_KEY
+// Boots since the flash was erased, the server accepts a sequence that starts
+// over after a power loss because the epoch went up.
+RTC_DATA_ATTR uint32_t epoch = 0;
+
+inline void beginEpoch()
+{
+  if (esp_reset_reason() == ESP_RST_DEEPSLEEP && epoch != 0)
+  {
+    return;
+  }
+
+  Preferences preferences;
+  preferences.begin("udp-auth", false);
+  epoch = preferences.getUInt("epoch", 0) + 1;
+  preferences.putUInt("epoch", epoch);
+  preferences.end();
+}
+#endif
+
 constexpr uint64_t uS_TO_S_FACTOR = 1000000ULL; /* Conversion factor for micro seconds to seconds */
 constexpr uint32_t TIME_TO_SLEEP = 10 * 60;     /* Time ESP32 will go to sleep (in seconds) */
 
@@ -35,9 +60,17 @@ void sendDataTask(BME280Handler &bme)
 
   UDPBroadcast broadcast;
   SensorData data{};
+  uint8_t frame[UDPFrame::MAX_SIZE];
 
+  String deviceID = WiFi.macAddress();
   uint32_t analogVolts = 0;
 
+#ifdef UDP_AUTH_KEY
+  beginEpoch();
+#endif
+
+  sequence++;
+
   for (uint8_t packetCounter = 0; packetCounter < PACKETS_COUNT;)
   {
     if (!bme.readSensor(data))
@@ -52,7 +85,19 @@ void sendDataTask(BME280Handler &bme)
     DEBUG_PRINTF(" temperature=%f humidity=%f pressure=%f voltage=%f\n", data.temperature, data.humidity, data.pressure, data.voltage);
 #endif
 
-    if (broadcast.send(&data, sizeof(data)))
+#ifdef UDP_AUTH_KEY
+    // secrets.h: #define UDP_AUTH_KEY {0x00, 0x01, ...}, the same key as in the server -auth-keys file
+    static const uint8_t key[] = UDP_AUTH_KEY;
+    size_t size = UDPFrame::encode(deviceID.c_str(), sequence, data, frame, key, sizeof(key), epoch);
+#else
+    size_t size = UDPFrame::encode(deviceID.c_str(), sequence, data, frame);
+#endif
+    if (size == 0)
+    {
+      break;
+    }
+
+    if (broadcast.send(frame, size))
     {
       packetCounter++;
       if (packetCounter < PACKETS_COUNT)
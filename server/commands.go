@@ -0,0 +1,348 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"temperature-sensor/internal/archive"
+	"temperature-sensor/internal/capture"
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/dataset"
+	"temperature-sensor/internal/ingest"
+	"temperature-sensor/internal/packet"
+)
+
+var (
+	errDataDirRequired = errors.New("-data-dir is required")
+	errDeviceRequired  = errors.New("-device is required")
+)
+
+// runCommand runs a subcommand given as the first argument and reports
+// whether there was one.
+func runCommand(args []string) (bool, error) {
+	if len(args) == 0 {
+		return false, nil
+	}
+
+	var run func(args []string) error
+
+	switch args[0] {
+	case "export":
+		run = runExport
+	case "import":
+		run = runImport
+	case "replay":
+		run = runReplay
+	case "resync":
+		run = runResync
+	default:
+		return false, nil
+	}
+
+	// stdout may carry the command output
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+
+	return true, run(args[1:])
+}
+
+func runExport(args []string) error {
+	cfg, err := config.ExportFromFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.DataDir == "" {
+		return errDataDirRequired
+	}
+
+	format, err := archive.ParseFormat(cfg.Format)
+	if err != nil {
+		return err
+	}
+
+	units, err := archive.ParseUnits(cfg.PressureUnit, cfg.TemperatureUnit)
+	if err != nil {
+		return err
+	}
+
+	out, closeOut, err := openOutput(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	filter := archive.Filter{Device: cfg.Device, From: cfg.From, To: cfg.To}
+
+	count, err := archive.Export(archive.NewWriter(out, format, units), func(fn func(data packet.Packet)) error {
+		return dataset.ReadFileStorage(cfg.DataDir, fn)
+	}, filter)
+
+	if closeErr := closeOut(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	slog.Info("exported readings", "count", count, "output", cfg.Output)
+
+	return nil
+}
+
+// runImport appends readings to the file storage. The service must be
+// stopped, it only picks the readings up on restart.
+func runImport(args []string) (err error) {
+	cfg, err := config.ImportFromFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.DataDir == "" {
+		return errDataDirRequired
+	}
+
+	format, err := archive.ParseFormat(cfg.Format)
+	if err != nil {
+		return err
+	}
+
+	in, closeIn, err := openInput(cfg.Input)
+	if err != nil {
+		return err
+	}
+
+	defer closeIn()
+
+	storage, err := dataset.NewFileStorage(cfg.DataDir)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if closeErr := storage.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+
+	stats := dataset.NewStats(cfg.Dataset, storage)
+
+	// the saved aggregates are replaced with the imported readings folded in
+	if err := stats.Restore(time.Now()); err != nil {
+		return err
+	}
+
+	result, err := stats.Import(time.Now(), func(fn func(data packet.Packet) error) error {
+		return archive.Read(in, format, cfg.Device, fn)
+	})
+
+	slog.Info("imported readings", "imported", result.Imported,
+		"duplicates", result.Duplicates, "expired", result.Expired)
+
+	return err
+}
+
+// runReplay feeds a capture through the decoders and the ingest pipeline of
+// the service and writes the readings that come out.
+func runReplay(args []string) error {
+	cfg, err := config.ReplayFromFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	format, err := archive.ParseFormat(cfg.Format)
+	if err != nil {
+		return err
+	}
+
+	decoders, err := replayDecoders(cfg)
+	if err != nil {
+		return err
+	}
+
+	in, closeIn, err := openInput(cfg.Input)
+	if err != nil {
+		return err
+	}
+
+	defer closeIn()
+
+	out, closeOut, err := openOutput(cfg.Output)
+	if err != nil {
+		return err
+	}
+
+	writer := &writerEmitter{writer: archive.NewWriter(out, format, archive.Units{
+		Pressure:    archive.PressureMmHg,
+		Temperature: archive.TemperatureCelsius,
+	})}
+	tracker := ingest.NewLossTracker(ingest.NewDeduplicator(writer, cfg.DedupWindow))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := capture.Replay(ctx, in, decoders, cfg.Speed, tracker)
+	err = errors.Join(err, writer.err, writer.writer.Flush(), closeOut())
+
+	slog.Info("replayed capture", "frames", result.Frames, "emitted", result.Emitted,
+		"written", writer.count, "unrecognized", result.Unrecognized, "failed", result.Failed)
+
+	for device, link := range tracker.Links() {
+		slog.Info("link quality", "device", device, "expected", link.Expected, "received", link.Received,
+			"lost", link.Lost, "retransmits", link.Retransmits, "loss_rate", link.LossRate)
+	}
+
+	return err
+}
+
+func replayDecoders(cfg config.Replay) (capture.Decoders, error) {
+	// counters of the service are not touched, a capture replays from scratch
+	verifier, err := openVerifier(cfg.Auth, "")
+	if err != nil {
+		return nil, err
+	}
+
+	fields, err := packet.ParseJSONFields(cfg.JSONFields)
+	if err != nil {
+		return nil, fmt.Errorf("mqtt json fields: %w", err)
+	}
+
+	udpDecoder, err := packet.NewDecoder(cfg.UDPDecoders, packet.DecoderOptions{Verifier: verifier})
+	if err != nil {
+		return nil, fmt.Errorf("udp decoders: %w", err)
+	}
+
+	serialDecoder, err := packet.NewDecoder(cfg.SerialDecoders, packet.DecoderOptions{
+		Verifier: verifier,
+		Tag:      cfg.SerialTag,
+		Names:    cfg.SerialNames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("serial decoders: %w", err)
+	}
+
+	mqttDecoder, err := packet.NewDecoder(cfg.MQTTDecoders, packet.DecoderOptions{
+		Verifier:   verifier,
+		JSONFields: fields,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mqtt decoders: %w", err)
+	}
+
+	return capture.Decoders{
+		capture.TransportUDP:    udpDecoder,
+		capture.TransportSerial: serialDecoder,
+		capture.TransportMQTT:   mqttDecoder,
+	}, nil
+}
+
+// writerEmitter writes emitted readings, keeping the first error.
+type writerEmitter struct {
+	writer archive.Writer
+	count  int
+	err    error
+}
+
+func (w *writerEmitter) Emit(data packet.Packet) {
+	if w.err != nil {
+		return
+	}
+
+	w.err = w.writer.Write(data)
+	if w.err == nil {
+		w.count++
+	}
+}
+
+// runResync forgets the authentication counter of a device, so a sensor
+// whose flash was erased and counts its epochs from the start again is
+// accepted. The service must be stopped, it saves its own counters.
+func runResync(args []string) error {
+	cfg, err := config.ResyncFromFlags(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if cfg.DataDir == "" {
+		return errDataDirRequired
+	}
+
+	if cfg.Device == "" {
+		return errDeviceRequired
+	}
+
+	store := packet.NewCounterFile(cfg.DataDir)
+
+	counters, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	last, ok := counters[cfg.Device]
+	if !ok {
+		slog.Info("no counter kept for device", "device", cfg.Device)
+
+		return nil
+	}
+
+	delete(counters, cfg.Device)
+
+	if err := store.Save(counters); err != nil {
+		return err
+	}
+
+	slog.Info("counter forgotten", "device", cfg.Device, "last", last)
+
+	return nil
+}
+
+// openInput opens a file for reading, - stands for stdin.
+func openInput(path string) (io.Reader, func() error, error) {
+	if path == "-" {
+		return os.Stdin, func() error { return nil }, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open input: %w", err)
+	}
+
+	return file, file.Close, nil
+}
+
+// openOutput opens a file for writing, - stands for stdout.
+func openOutput(path string) (io.Writer, func() error, error) {
+	if path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create output: %w", err)
+	}
+
+	return file, file.Close, nil
+}
@@ -0,0 +1,298 @@
+package archive
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+type Format string
+
+const (
+	FormatCSV    Format = "csv"
+	FormatNDJSON Format = "ndjson"
+)
+
+type PressureUnit string
+
+const (
+	PressureMmHg PressureUnit = "mmhg"
+	PressureHPa  PressureUnit = "hpa"
+)
+
+type TemperatureUnit string
+
+const (
+	TemperatureCelsius    TemperatureUnit = "c"
+	TemperatureFahrenheit TemperatureUnit = "f"
+)
+
+const (
+	fieldTimestamp = "timestamp"
+	fieldDevice    = "device"
+	fieldHumidity  = "humidity_percent"
+	fieldVoltage   = "voltage_mv"
+
+	mmHgToPascal = 133.322
+)
+
+var (
+	errUnknownFormat          = errors.New("unknown format, use csv or ndjson")
+	errUnknownPressureUnit    = errors.New("unknown pressure unit, use mmhg or hpa")
+	errUnknownTemperatureUnit = errors.New("unknown temperature unit, use c or f")
+)
+
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatCSV, FormatNDJSON:
+		return f, nil
+	default:
+		return "", fmt.Errorf("%w: %s", errUnknownFormat, s)
+	}
+}
+
+// Units of exported values. Packets always carry °C and mmHg.
+type Units struct {
+	Pressure    PressureUnit
+	Temperature TemperatureUnit
+}
+
+func ParseUnits(pressure, temperature string) (Units, error) {
+	units := Units{
+		Pressure:    PressureUnit(strings.ToLower(pressure)),
+		Temperature: TemperatureUnit(strings.ToLower(temperature)),
+	}
+
+	switch units.Pressure {
+	case PressureMmHg, PressureHPa:
+	default:
+		return Units{}, fmt.Errorf("%w: %s", errUnknownPressureUnit, pressure)
+	}
+
+	switch units.Temperature {
+	case TemperatureCelsius, TemperatureFahrenheit:
+	default:
+		return Units{}, fmt.Errorf("%w: %s", errUnknownTemperatureUnit, temperature)
+	}
+
+	return units, nil
+}
+
+func (u Units) temperatureField() string {
+	return "temperature_" + string(u.Temperature)
+}
+
+func (u Units) pressureField() string {
+	return "pressure_" + string(u.Pressure)
+}
+
+func (u Units) temperature(celsius float32) float32 {
+	if u.Temperature == TemperatureFahrenheit {
+		return celsius*9/5 + 32
+	}
+
+	return celsius
+}
+
+func (u Units) pressure(mmHg float32) float32 {
+	if u.Pressure == PressureHPa {
+		return mmHg * mmHgToPascal / 100
+	}
+
+	return mmHg
+}
+
+// Filter selects exported packets, zero fields match everything.
+type Filter struct {
+	Device string
+	From   time.Time
+	To     time.Time
+}
+
+func (f Filter) Match(data packet.Packet) bool {
+	if f.Device != "" && data.Device != f.Device {
+		return false
+	}
+
+	if !f.From.IsZero() && data.Timestamp.Before(f.From) {
+		return false
+	}
+
+	if !f.To.IsZero() && data.Timestamp.After(f.To) {
+		return false
+	}
+
+	return true
+}
+
+// Writer encodes packets one by one, so exports are streamed.
+type Writer interface {
+	Write(data packet.Packet) error
+	Flush() error
+}
+
+func NewWriter(w io.Writer, format Format, units Units) Writer {
+	if format == FormatNDJSON {
+		return &ndjsonWriter{encoder: json.NewEncoder(w), units: units}
+	}
+
+	return &csvWriter{writer: csv.NewWriter(w), units: units}
+}
+
+// ContentType returns the media type of an export format.
+func (f Format) ContentType() string {
+	if f == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+
+	return "text/csv; charset=utf-8"
+}
+
+// metricValue is an exported metric, present unless the source did not send it.
+type metricValue struct {
+	field   string
+	value   float32
+	present bool
+}
+
+// metricValues returns the metrics of a packet in the order of the CSV columns.
+func (u Units) metricValues(data packet.Packet) []metricValue {
+	return []metricValue{
+		{u.temperatureField(), u.temperature(data.Temperature), data.Has(packet.FieldTemperature)},
+		{fieldHumidity, data.Humidity, data.Has(packet.FieldHumidity)},
+		{u.pressureField(), u.pressure(data.Pressure), data.Has(packet.FieldPressure)},
+		{fieldVoltage, data.Voltage, data.Has(packet.FieldVoltage)},
+	}
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	units  Units
+	header bool
+}
+
+func formatFloat(v float32) string {
+	return strconv.FormatFloat(float64(v), 'f', 2, 32)
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+
+	w.header = true
+
+	err := w.writer.Write([]string{
+		fieldTimestamp,
+		fieldDevice,
+		w.units.temperatureField(),
+		fieldHumidity,
+		w.units.pressureField(),
+		fieldVoltage,
+	})
+	if err != nil {
+		return fmt.Errorf("write csv header: %w", err)
+	}
+
+	return nil
+}
+
+func (w *csvWriter) Write(data packet.Packet) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	row := []string{data.Timestamp.Format(time.RFC3339Nano), data.Device}
+
+	// a missing metric is an empty cell, not a zero
+	for _, m := range w.units.metricValues(data) {
+		cell := ""
+		if m.present {
+			cell = formatFloat(m.value)
+		}
+
+		row = append(row, cell)
+	}
+
+	if err := w.writer.Write(row); err != nil {
+		return fmt.Errorf("write csv: %w", err)
+	}
+
+	return nil
+}
+
+// Flush writes the header even if nothing matched.
+func (w *csvWriter) Flush() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	w.writer.Flush()
+
+	return w.writer.Error()
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+	units   Units
+}
+
+func (w *ndjsonWriter) Write(data packet.Packet) error {
+	record := map[string]any{
+		fieldTimestamp: data.Timestamp.Format(time.RFC3339Nano),
+		fieldDevice:    data.Device,
+	}
+
+	for _, m := range w.units.metricValues(data) {
+		if m.present {
+			record[m.field] = toFixed(m.value)
+		}
+	}
+
+	if err := w.encoder.Encode(record); err != nil {
+		return fmt.Errorf("write ndjson: %w", err)
+	}
+
+	return nil
+}
+
+func (w *ndjsonWriter) Flush() error {
+	return nil
+}
+
+func toFixed(v float32) json.Number {
+	return json.Number(formatFloat(v))
+}
+
+// Export writes every packet loaded by load that matches the filter.
+func Export(w Writer, load func(fn func(data packet.Packet)) error, filter Filter) (int, error) {
+	var (
+		count    int
+		writeErr error
+	)
+
+	err := load(func(data packet.Packet) {
+		if writeErr != nil || !filter.Match(data) {
+			return
+		}
+
+		writeErr = w.Write(data)
+		count++
+	})
+	if err != nil {
+		return count, fmt.Errorf("load readings: %w", err)
+	}
+
+	if writeErr != nil {
+		return count, writeErr
+	}
+
+	return count, w.Flush()
+}
@@ -0,0 +1,126 @@
+package archive_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/archive"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testPackets() []packet.Packet {
+	start := time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	return []packet.Packet{
+		{Device: "balcony", Timestamp: start, Temperature: 20, Humidity: 40, Pressure: 750, Voltage: 3300},
+		{Device: "bedroom", Timestamp: start, Temperature: 22, Humidity: 45, Pressure: 751, Voltage: 3100},
+		{Device: "balcony", Timestamp: start.Add(time.Hour), Temperature: -5, Humidity: 41.5, Pressure: 760, Voltage: 3290},
+	}
+}
+
+func loadPackets(packets []packet.Packet) func(fn func(data packet.Packet)) error {
+	return func(fn func(data packet.Packet)) error {
+		for _, p := range packets {
+			fn(p)
+		}
+
+		return nil
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	units, err := archive.ParseUnits("mmHg", "C")
+	require.NoError(t, err)
+
+	count, err := archive.Export(archive.NewWriter(&buf, archive.FormatCSV, units), loadPackets(testPackets()),
+		archive.Filter{Device: "balcony"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	expected := `timestamp,device,temperature_c,humidity_percent,pressure_mmhg,voltage_mv
+2023-10-01T08:00:00Z,balcony,20.00,40.00,750.00,3300.00
+2023-10-01T09:00:00Z,balcony,-5.00,41.50,760.00,3290.00
+`
+	assert.Equal(t, expected, buf.String())
+}
+
+func TestExportNDJSONUnits(t *testing.T) {
+	var buf bytes.Buffer
+
+	units, err := archive.ParseUnits("hpa", "f")
+	require.NoError(t, err)
+
+	filter := archive.Filter{
+		From: time.Date(2023, 10, 1, 8, 30, 0, 0, time.UTC),
+		To:   time.Date(2023, 10, 1, 9, 0, 0, 0, time.UTC),
+	}
+
+	count, err := archive.Export(archive.NewWriter(&buf, archive.FormatNDJSON, units), loadPackets(testPackets()), filter)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	assert.JSONEq(t, `{
+		"timestamp": "2023-10-01T09:00:00Z",
+		"device": "balcony",
+		"temperature_f": 23.00,
+		"humidity_percent": 41.50,
+		"pressure_hpa": 1013.25,
+		"voltage_mv": 3290.00
+	}`, buf.String())
+}
+
+func TestExportMissing(t *testing.T) {
+	units, err := archive.ParseUnits("mmhg", "c")
+	require.NoError(t, err)
+
+	partial := []packet.Packet{{
+		Device:      "bedroom",
+		Timestamp:   time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC),
+		Temperature: 21.5,
+		Missing:     []string{packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage},
+	}}
+
+	var buf bytes.Buffer
+
+	_, err = archive.Export(archive.NewWriter(&buf, archive.FormatCSV, units), loadPackets(partial), archive.Filter{})
+	require.NoError(t, err)
+	assert.Equal(t, `timestamp,device,temperature_c,humidity_percent,pressure_mmhg,voltage_mv
+2023-10-01T08:00:00Z,bedroom,21.50,,,
+`, buf.String())
+
+	buf.Reset()
+
+	_, err = archive.Export(archive.NewWriter(&buf, archive.FormatNDJSON, units), loadPackets(partial), archive.Filter{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"timestamp": "2023-10-01T08:00:00Z", "device": "bedroom", "temperature_c": 21.50}`, buf.String())
+}
+
+func TestExportEmptyCSVHasHeader(t *testing.T) {
+	var buf bytes.Buffer
+
+	units, err := archive.ParseUnits("mmhg", "c")
+	require.NoError(t, err)
+
+	count, err := archive.Export(archive.NewWriter(&buf, archive.FormatCSV, units), loadPackets(nil), archive.Filter{})
+	require.NoError(t, err)
+	assert.Zero(t, count)
+	assert.True(t, strings.HasPrefix(buf.String(), "timestamp,device,"))
+}
+
+func TestParseErrors(t *testing.T) {
+	_, err := archive.ParseFormat("xml")
+	require.Error(t, err)
+
+	_, err = archive.ParseUnits("bar", "c")
+	require.Error(t, err)
+
+	_, err = archive.ParseUnits("hpa", "k")
+	require.Error(t, err)
+}
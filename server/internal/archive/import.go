@@ -0,0 +1,216 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+var (
+	errMissingTimestamp = errors.New("missing timestamp")
+	errMissingMetrics   = errors.New("no metric values")
+	errInvalidValue     = errors.New("invalid value")
+)
+
+//nolint:gochecknoglobals
+var metrics = []string{packet.FieldTemperature, packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage}
+
+// column converts an imported value of metric to the unit packets carry.
+type column struct {
+	metric  string
+	set     func(p *packet.Packet, v float32)
+	convert func(v float32) float32
+}
+
+func identity(v float32) float32 { return v }
+
+func fahrenheitToCelsius(v float32) float32 { return (v - 32) * 5 / 9 }
+
+func hPaToMmHg(v float32) float32 { return v * 100 / mmHgToPascal }
+
+func setTemperature(p *packet.Packet, v float32) { p.Temperature = v }
+func setHumidity(p *packet.Packet, v float32)    { p.Humidity = v }
+func setPressure(p *packet.Packet, v float32)    { p.Pressure = v }
+func setVoltage(p *packet.Packet, v float32)     { p.Voltage = v }
+
+// columns accepts the exported field names and bare metric names, the latter
+// in the units packets carry.
+//
+//nolint:gochecknoglobals
+var columns = map[string]column{
+	"temperature":   {packet.FieldTemperature, setTemperature, identity},
+	"temperature_c": {packet.FieldTemperature, setTemperature, identity},
+	"temperature_f": {packet.FieldTemperature, setTemperature, fahrenheitToCelsius},
+	"humidity":      {packet.FieldHumidity, setHumidity, identity},
+	fieldHumidity:   {packet.FieldHumidity, setHumidity, identity},
+	"pressure":      {packet.FieldPressure, setPressure, identity},
+	"pressure_mmhg": {packet.FieldPressure, setPressure, identity},
+	"pressure_hpa":  {packet.FieldPressure, setPressure, hPaToMmHg},
+	"voltage":       {packet.FieldVoltage, setVoltage, identity},
+	fieldVoltage:    {packet.FieldVoltage, setVoltage, identity},
+}
+
+// record builds a packet from named fields, unknown fields are ignored.
+// Metrics without a value are missing, a record needs at least one.
+func record(fields map[string]string, device string) (packet.Packet, error) {
+	p := packet.Packet{Device: device}
+
+	if v := fields[fieldDevice]; v != "" {
+		p.Device = v
+	}
+
+	timestamp, ok := fields[fieldTimestamp]
+	if !ok || timestamp == "" {
+		return packet.Packet{}, errMissingTimestamp
+	}
+
+	t, err := parseTimestamp(timestamp)
+	if err != nil {
+		return packet.Packet{}, err
+	}
+
+	p.Timestamp = t
+	found := make(map[string]bool, len(metrics))
+
+	for name, value := range fields {
+		col, ok := columns[name]
+		if !ok || value == "" {
+			continue
+		}
+
+		v, err := strconv.ParseFloat(value, 32)
+		if err != nil {
+			return packet.Packet{}, fmt.Errorf("%w: %s=%q", errInvalidValue, name, value)
+		}
+
+		col.set(&p, col.convert(float32(v)))
+		found[col.metric] = true
+	}
+
+	if len(found) == 0 {
+		return packet.Packet{}, errMissingMetrics
+	}
+
+	for _, metric := range metrics {
+		if !found[metric] {
+			p.Missing = append(p.Missing, metric)
+		}
+	}
+
+	return p, nil
+}
+
+func parseTimestamp(value string) (time.Time, error) {
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: timestamp=%q", errInvalidValue, value)
+	}
+
+	return t, nil
+}
+
+// Read decodes packets written by Export and passes them to fn. Readings
+// without a device column are attributed to device. Errors carry the line.
+func Read(r io.Reader, format Format, device string, fn func(data packet.Packet) error) error {
+	if format == FormatNDJSON {
+		return readNDJSON(r, device, fn)
+	}
+
+	return readCSV(r, device, fn)
+}
+
+func readCSV(r io.Reader, device string, fn func(data packet.Packet) error) error {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("read csv header: %w", err)
+	}
+
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	reader.FieldsPerRecord = len(header)
+	fields := make(map[string]string, len(header))
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("read csv: %w", err)
+		}
+
+		for i, name := range header {
+			fields[name] = row[i]
+		}
+
+		p, err := record(fields, device)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := fn(p); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+func readNDJSON(r io.Reader, device string, fn func(data packet.Packet) error) error {
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+
+		var object map[string]any
+
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+
+		if err := decoder.Decode(&object); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		fields := make(map[string]string, len(object))
+
+		for name, value := range object {
+			if value != nil {
+				fields[strings.ToLower(name)] = fmt.Sprint(value)
+			}
+		}
+
+		p, err := record(fields, device)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := fn(p); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read ndjson: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,125 @@
+package archive_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/archive"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, input string, format archive.Format) []packet.Packet {
+	t.Helper()
+
+	var packets []packet.Packet
+
+	err := archive.Read(strings.NewReader(input), format, "default", func(data packet.Packet) error {
+		packets = append(packets, data)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	return packets
+}
+
+func TestReadRoundTrip(t *testing.T) {
+	units, err := archive.ParseUnits("hpa", "f")
+	require.NoError(t, err)
+
+	for _, format := range []archive.Format{archive.FormatCSV, archive.FormatNDJSON} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+
+			_, err := archive.Export(archive.NewWriter(&buf, format, units), loadPackets(testPackets()), archive.Filter{})
+			require.NoError(t, err)
+
+			packets := readAll(t, buf.String(), format)
+			require.Len(t, packets, len(testPackets()))
+
+			for i, expected := range testPackets() {
+				assert.Equal(t, expected.Device, packets[i].Device)
+				assert.True(t, expected.Timestamp.Equal(packets[i].Timestamp))
+				assert.InDelta(t, expected.Temperature, packets[i].Temperature, 0.01)
+				assert.InDelta(t, expected.Humidity, packets[i].Humidity, 0.01)
+				assert.InDelta(t, expected.Pressure, packets[i].Pressure, 0.01)
+				assert.InDelta(t, expected.Voltage, packets[i].Voltage, 0.01)
+			}
+		})
+	}
+}
+
+func TestReadRoundTripMissing(t *testing.T) {
+	units, err := archive.ParseUnits("mmhg", "c")
+	require.NoError(t, err)
+
+	partial := packet.Packet{
+		Device:      "bedroom",
+		Timestamp:   time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC),
+		Temperature: 21.5,
+		Missing:     []string{packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage},
+	}
+
+	for _, format := range []archive.Format{archive.FormatCSV, archive.FormatNDJSON} {
+		var buf bytes.Buffer
+
+		_, err := archive.Export(archive.NewWriter(&buf, format, units), loadPackets([]packet.Packet{partial}),
+			archive.Filter{})
+		require.NoError(t, err)
+
+		packets := readAll(t, buf.String(), format)
+		require.Len(t, packets, 1, format)
+		assert.Equal(t, partial.Missing, packets[0].Missing, format)
+	}
+}
+
+func TestReadDefaultsAndMetricNames(t *testing.T) {
+	csv := `Timestamp,Temperature,Humidity
+1696147200000,21.5,40
+`
+	packets := readAll(t, csv, archive.FormatCSV)
+	require.Len(t, packets, 1)
+	assert.Equal(t, "default", packets[0].Device)
+	assert.True(t, time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC).Equal(packets[0].Timestamp))
+	assert.InDelta(t, 21.5, packets[0].Temperature, 1e-6)
+	assert.Equal(t, []string{packet.FieldPressure, packet.FieldVoltage}, packets[0].Missing)
+
+	ndjson := `{"timestamp": 1696147200000, "device": "balcony", "pressure": 750, "voltage": null}
+
+{"timestamp": "2023-10-01T09:00:00Z", "temperature_c": -3}
+`
+	packets = readAll(t, ndjson, archive.FormatNDJSON)
+	require.Len(t, packets, 2)
+	assert.Equal(t, "balcony", packets[0].Device)
+	assert.InDelta(t, 750, packets[0].Pressure, 1e-6)
+	// null is no value
+	assert.Equal(t, []string{packet.FieldTemperature, packet.FieldHumidity, packet.FieldVoltage}, packets[0].Missing)
+	assert.Equal(t, "default", packets[1].Device)
+}
+
+func TestReadErrors(t *testing.T) {
+	tests := map[string]struct {
+		input  string
+		format archive.Format
+		err    string
+	}{
+		"missing timestamp": {"temperature\n20\n", archive.FormatCSV, "line 2: missing timestamp"},
+		"invalid value":     {"timestamp,temperature\n1696147200000,warm\n", archive.FormatCSV, "line 2: invalid value"},
+		"invalid json":      {"{\"timestamp\": 1, \"voltage\": 3000}\n{\n", archive.FormatNDJSON, "line 2:"},
+		"invalid timestamp": {`{"timestamp": "yesterday"}`, archive.FormatNDJSON, "line 1: invalid value"},
+		"no metrics":        {"timestamp,temperature,humidity\n1696147200000,,\n", archive.FormatCSV, "line 2: no metric"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := archive.Read(strings.NewReader(tt.input), tt.format, "", func(packet.Packet) error { return nil })
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
@@ -0,0 +1,48 @@
+package backoff
+
+import (
+	"context"
+	"time"
+)
+
+// Backoff doubles the delay after every failure, from Min up to Max.
+type Backoff struct {
+	Min time.Duration
+	Max time.Duration
+
+	next time.Duration
+}
+
+func New(minDelay, maxDelay time.Duration) *Backoff {
+	return &Backoff{Min: minDelay, Max: max(minDelay, maxDelay)}
+}
+
+// Next returns the delay before the next attempt.
+func (b *Backoff) Next() time.Duration {
+	if b.next == 0 {
+		b.next = b.Min
+	}
+
+	delay := b.next
+	b.next = min(b.next*2, b.Max)
+
+	return delay
+}
+
+// Reset starts over from Min after a success.
+func (b *Backoff) Reset() {
+	b.next = 0
+}
+
+// Wait sleeps for the next delay, it returns false when ctx is done first.
+func (b *Backoff) Wait(ctx context.Context) bool {
+	timer := time.NewTimer(b.Next())
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,36 @@
+package backoff_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/backoff"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	b := backoff.New(time.Second, 5*time.Second)
+
+	delays := make([]time.Duration, 0, 5)
+	for range 5 {
+		delays = append(delays, b.Next())
+	}
+
+	assert.Equal(t, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}, delays)
+
+	b.Reset()
+	assert.Equal(t, time.Second, b.Next())
+}
+
+func TestBackoffWait(t *testing.T) {
+	b := backoff.New(time.Millisecond, time.Millisecond)
+	assert.True(t, b.Wait(t.Context()))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	b = backoff.New(time.Hour, time.Hour)
+	assert.False(t, b.Wait(ctx))
+}
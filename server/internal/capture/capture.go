@@ -0,0 +1,86 @@
+package capture
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Transports of recorded frames.
+const (
+	TransportUDP    = "udp"
+	TransportMQTT   = "mqtt"
+	TransportSerial = "serial"
+)
+
+const fileMode = 0o600
+
+// Frame is one raw message of a source, a line of a capture file.
+type Frame struct {
+	Time      time.Time `json:"time"`
+	Transport string    `json:"transport"`
+	// Source is the UDP sender, MQTT topic or serial port.
+	Source string `json:"source"`
+	// Device is the device the transport attributes the frame to, decoders
+	// that read a device id replace it.
+	Device string `json:"device"`
+	Data   []byte `json:"data"`
+}
+
+// Writer appends frames to a capture file. A nil Writer records nothing, so
+// sources call it unconditionally.
+type Writer struct {
+	file    *os.File
+	encoder *json.Encoder
+	mu      sync.Mutex
+}
+
+// Open appends to the capture file at path, nil when path is empty.
+func Open(path string) (*Writer, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open capture: %w", err)
+	}
+
+	return &Writer{file: file, encoder: json.NewEncoder(file)}, nil
+}
+
+// Record appends a frame received now.
+func (w *Writer) Record(transport, source, device string, data []byte) {
+	if w == nil {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	frame := Frame{
+		Time:      time.Now(),
+		Transport: transport,
+		Source:    source,
+		Device:    device,
+		Data:      data,
+	}
+
+	if err := w.encoder.Encode(frame); err != nil {
+		slog.Error("failed to record frame", "transport", transport, "source", source, "error", err)
+	}
+}
+
+func (w *Writer) Close() error {
+	if w == nil {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.file.Close()
+}
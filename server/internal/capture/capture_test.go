@@ -0,0 +1,156 @@
+package capture_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/capture"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceEmitter []packet.Packet
+
+func (e *sliceEmitter) Emit(p packet.Packet) {
+	*e = append(*e, p)
+}
+
+func fixtureDecoders(t *testing.T) capture.Decoders {
+	t.Helper()
+
+	udp, err := packet.NewDecoder([]string{packet.DecoderUDPFrame}, packet.DecoderOptions{})
+	require.NoError(t, err)
+
+	serial, err := packet.NewDecoder([]string{packet.DecoderSerialLogLine}, packet.DecoderOptions{
+		Tag:   "qf8mzr",
+		Names: map[string]string{"24:0A:C4:12:34:56": "balcony"},
+	})
+	require.NoError(t, err)
+
+	fields, err := packet.ParseJSONFields("temperature=temperature:c,humidity=humidity,pressure=pressure:hpa")
+	require.NoError(t, err)
+
+	mqtt, err := packet.NewDecoder([]string{packet.DecoderJSON}, packet.DecoderOptions{JSONFields: fields})
+	require.NoError(t, err)
+
+	return capture.Decoders{
+		capture.TransportUDP:    udp,
+		capture.TransportSerial: serial,
+		capture.TransportMQTT:   mqtt,
+	}
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "capture.ndjson")
+
+	w, err := capture.Open(path)
+	require.NoError(t, err)
+
+	w.Record(capture.TransportUDP, "192.168.1.20:4210", "192.168.1.20", []byte{0x00, 0xff})
+	w.Record(capture.TransportSerial, "/dev/ttyACM0", "qf8mzr", []byte("I (1) wifi: connected"))
+	require.NoError(t, w.Close())
+
+	// appends to an existing capture
+	w, err = capture.Open(path)
+	require.NoError(t, err)
+
+	w.Record(capture.TransportMQTT, "sensors/balcony/espnow", "balcony", []byte("{}"))
+	require.NoError(t, w.Close())
+
+	in, err := os.Open(path)
+	require.NoError(t, err)
+
+	defer in.Close()
+
+	var frames []capture.Frame
+
+	require.NoError(t, capture.Read(in, func(f capture.Frame) error {
+		frames = append(frames, f)
+
+		return nil
+	}))
+
+	require.Len(t, frames, 3)
+	assert.Equal(t, capture.TransportUDP, frames[0].Transport)
+	assert.Equal(t, "192.168.1.20:4210", frames[0].Source)
+	assert.Equal(t, []byte{0x00, 0xff}, frames[0].Data)
+	assert.Equal(t, "qf8mzr", frames[1].Device)
+	assert.Equal(t, "sensors/balcony/espnow", frames[2].Source)
+	assert.WithinDuration(t, time.Now(), frames[2].Time, time.Minute)
+}
+
+func TestNilWriter(t *testing.T) {
+	w, err := capture.Open("")
+	require.NoError(t, err)
+	assert.Nil(t, w)
+
+	w.Record(capture.TransportUDP, "", "", nil)
+	assert.NoError(t, w.Close())
+}
+
+func TestReplayFixture(t *testing.T) {
+	in, err := os.Open("testdata/capture.ndjson")
+	require.NoError(t, err)
+
+	defer in.Close()
+
+	var emitted sliceEmitter
+
+	result, err := capture.Replay(t.Context(), in, fixtureDecoders(t), 0, &emitted)
+	require.NoError(t, err)
+	assert.Equal(t, capture.Result{Frames: 4, Emitted: 3, Unrecognized: 1}, result)
+
+	require.Len(t, emitted, 3)
+
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	assert.Equal(t, "balcony", emitted[0].Device)
+	assert.Equal(t, -67, emitted[0].RSSI)
+	assert.InDelta(t, 23.14, emitted[0].Temperature, 1e-3)
+	assert.Equal(t, start, emitted[0].Timestamp)
+
+	assert.Equal(t, "bedroom", emitted[1].Device)
+	assert.InDelta(t, 20.5, emitted[1].Temperature, 1e-3)
+	assert.Equal(t, start.Add(time.Second), emitted[1].Timestamp)
+
+	assert.Equal(t, "greenhouse", emitted[2].Device)
+	assert.Equal(t, uint32(7), emitted[2].Sequence)
+	assert.InDelta(t, 21.5, emitted[2].Temperature, 1e-3)
+	assert.Equal(t, start.Add(2*time.Second), emitted[2].Timestamp)
+}
+
+func TestReplaySpeed(t *testing.T) {
+	input := `{"time":"2026-01-02T03:04:05Z","transport":"udp","data":""}
+{"time":"2026-01-02T03:04:06Z","transport":"udp","data":""}
+`
+
+	begin := time.Now()
+
+	result, err := capture.Replay(t.Context(), strings.NewReader(input), fixtureDecoders(t), 10, &sliceEmitter{})
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Frames)
+
+	// the second of the capture takes a tenth
+	elapsed := time.Since(begin)
+	assert.GreaterOrEqual(t, elapsed, 100*time.Millisecond)
+	assert.Less(t, elapsed, time.Second)
+}
+
+func TestReplayErrors(t *testing.T) {
+	var emitted sliceEmitter
+
+	_, err := capture.Replay(t.Context(), strings.NewReader("{\"transport\":\"udp\"}\nnot json\n"),
+		fixtureDecoders(t), 0, &emitted)
+	require.ErrorContains(t, err, "line 2")
+
+	result, err := capture.Replay(t.Context(), strings.NewReader(`{"transport":"can","data":"AQI="}`),
+		fixtureDecoders(t), 0, &emitted)
+	require.NoError(t, err)
+	assert.Equal(t, capture.Result{Frames: 1, Failed: 1}, result)
+	assert.Empty(t, emitted)
+}
@@ -0,0 +1,138 @@
+package capture
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+// maxFrameLine fits the base64 of any datagram or log line.
+const maxFrameLine = 1 << 20
+
+var errUnknownTransport = errors.New("no decoder for transport")
+
+// Read passes every frame of a capture to fn, errors carry the line.
+func Read(r io.Reader, fn func(f Frame) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxFrameLine)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var f Frame
+		if err := json.Unmarshal(scanner.Bytes(), &f); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+
+		if err := fn(f); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read capture: %w", err)
+	}
+
+	return nil
+}
+
+// Decoders decode frames by transport.
+type Decoders map[string]packet.Decoder
+
+// Decode turns a frame into a packet stamped with the time it was recorded.
+func (d Decoders) Decode(f Frame) (packet.Packet, error) {
+	decoder, ok := d[f.Transport]
+	if !ok {
+		return packet.Packet{}, fmt.Errorf("%w: %s", errUnknownTransport, f.Transport)
+	}
+
+	p := packet.Packet{Device: f.Device}
+
+	if err := decoder.Decode(f.Data, &p); err != nil {
+		return packet.Packet{}, err
+	}
+
+	p.Timestamp = f.Time
+
+	return p, nil
+}
+
+type eventEmitter interface {
+	Emit(pack packet.Packet)
+}
+
+// Result counts the frames of a replay.
+type Result struct {
+	Frames  int `json:"frames"`
+	Emitted int `json:"emitted"`
+	// Unrecognized frames are in no format of the decoders, like the other
+	// lines of a serial log.
+	Unrecognized int `json:"unrecognized"`
+	Failed       int `json:"failed"`
+}
+
+// Replay decodes the frames of a capture and emits the packets, spaced as
+// they were recorded divided by speed. Speed 0 replays without waiting.
+func Replay(ctx context.Context, r io.Reader, decoders Decoders, speed float64, emitter eventEmitter) (Result, error) {
+	var (
+		result Result
+		first  time.Time
+		start  = time.Now()
+	)
+
+	err := Read(r, func(f Frame) error {
+		if first.IsZero() {
+			first = f.Time
+		}
+
+		if speed > 0 {
+			at := start.Add(time.Duration(float64(f.Time.Sub(first)) / speed))
+			if err := sleepUntil(ctx, at); err != nil {
+				return err
+			}
+		}
+
+		result.Frames++
+
+		p, err := decoders.Decode(f)
+
+		switch {
+		case errors.Is(err, packet.ErrUnrecognized):
+			result.Unrecognized++
+		case err != nil:
+			result.Failed++
+
+			slog.WarnContext(ctx, "failed to decode frame",
+				"transport", f.Transport, "source", f.Source, "time", f.Time, "error", err)
+		default:
+			result.Emitted++
+
+			emitter.Emit(p)
+		}
+
+		return nil
+	})
+
+	return result, err
+}
+
+func sleepUntil(ctx context.Context, at time.Time) error {
+	timer := time.NewTimer(time.Until(at))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
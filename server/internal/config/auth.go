@@ -0,0 +1,77 @@
+package config
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// minKeySize keeps keys at least as long as the truncated tag is worth.
+const minKeySize = 16
+
+var (
+	errInvalidKeyLine = errors.New("invalid key line, want device=hexkey")
+	errKeyTooShort    = errors.New("key too short")
+	errDuplicateKey   = errors.New("duplicate key")
+)
+
+type Auth struct {
+	KeysFile string
+}
+
+// LoadKeys reads per-device keys, see ParseKeys.
+func LoadKeys(path string) (map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open keys: %w", err)
+	}
+	defer file.Close()
+
+	return ParseKeys(file)
+}
+
+// ParseKeys parses device=hexkey lines, blank lines and lines starting with
+// # are skipped.
+func ParseKeys(r io.Reader) (map[string][]byte, error) {
+	keys := make(map[string][]byte)
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		device, hexKey, ok := strings.Cut(text, "=")
+		device = strings.TrimSpace(device)
+
+		if !ok || device == "" {
+			return nil, fmt.Errorf("line %d: %w", line, errInvalidKeyLine)
+		}
+
+		key, err := hex.DecodeString(strings.TrimSpace(hexKey))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w: %w", line, errInvalidKeyLine, err)
+		}
+
+		if len(key) < minKeySize {
+			return nil, fmt.Errorf("line %d: %w: %d bytes, want at least %d", line, errKeyTooShort, len(key), minKeySize)
+		}
+
+		if _, ok := keys[device]; ok {
+			return nil, fmt.Errorf("line %d: %w: %s", line, errDuplicateKey, device)
+		}
+
+		keys[device] = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read keys: %w", err)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,36 @@
+package config_test
+
+import (
+	"strings"
+	"testing"
+
+	"temperature-sensor/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := config.ParseKeys(strings.NewReader(`
+# balcony sensor
+balcony = 000102030405060708090a0b0c0d0e0f
+AA:BB:CC:DD:EE:FF=0f0e0d0c0b0a09080706050403020100ff
+`))
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Len(t, keys["balcony"], 16)
+	assert.Len(t, keys["AA:BB:CC:DD:EE:FF"], 17)
+
+	tests := map[string]string{
+		"balcony":                           "invalid key line",
+		"=000102030405060708090a0b0c0d0e0f": "invalid key line",
+		"balcony=zz":                        "invalid key line",
+		"balcony=0001":                      "key too short",
+		"a=000102030405060708090a0b0c0d0e0f\na=000102030405060708090a0b0c0d0e0f": "line 2: duplicate key",
+	}
+
+	for input, expected := range tests {
+		_, err := config.ParseKeys(strings.NewReader(input))
+		require.ErrorContains(t, err, expected, "input: %q", input)
+	}
+}
@@ -6,23 +6,60 @@ import (
 )
 
 const (
-	defaultHTTPAddr  = ":8001"
-	defaultUDPPort   = ":12345"
-	defaultEnableUDP = false
+	defaultHTTPAddr      = ":8001"
+	defaultImportToken   = ""
+	defaultUDPPort       = ":12345"
+	defaultEnableUDP     = false
+	defaultUDPQuarantine = ""
+	defaultUDPDecoders   = "udp-frame,legacy-udp"
 
-	defaultDevice       = "/dev/ttyACM0"
-	defaultDeviceTag    = "qf8mzr"
-	defaultEnableSerial = false
-	defaultBaudRate     = 115200
+	defaultDevice         = "/dev/ttyACM0"
+	defaultScanInterval   = 2 * time.Second
+	defaultSerialRetryMin = 1 * time.Second
+	defaultSerialRetryMax = 1 * time.Minute
+	defaultDeviceTag      = "qf8mzr"
+	defaultEnableSerial   = false
+	defaultBaudRate       = 115200
+	defaultSerialDecoders = "serial-log-line"
+
+	defaultDataDir = ""
+
+	defaultAuthKeys = ""
+
+	defaultDedupWindow = 30 * time.Second
+
+	defaultCaptureFile = ""
+
+	defaultRawRetention        = 48 * time.Hour
+	defaultFiveMinuteRetention = 7 * 24 * time.Hour
+	defaultHourRetention       = 90 * 24 * time.Hour
+	defaultDayRetention        = 365 * 24 * time.Hour
 
 	defaultEnableMQTT        = true
 	defaultBroker            = "tcp://raspberrypi.local:1883"
-	defaultClientID          = "go-mqtt-client"
+	defaultClientID          = ""
 	defaultKeepAliveDuration = 2 * time.Second
 	defaultPingTimeout       = 1 * time.Second
+	defaultRetryMin          = 1 * time.Second
+	defaultRetryMax          = 2 * time.Minute
+	defaultCleanSession      = false
 	defaultUsername          = ""
 	defaultPassword          = ""
 	defaultTopic             = ""
+	defaultDeviceSegment     = -1
+	defaultMQTTDecoders      = "espnow-frame"
+	defaultMQTTJSONFields    = "temperature=temperature:c,humidity=humidity,pressure=pressure:hpa,voltage=voltage:mv"
+	defaultPublishTopic      = ""
+	defaultPublishQoS        = 0
+	defaultPublishRetain     = true
+	defaultDiscovery         = false
+	defaultDiscoveryPrefix   = "homeassistant"
+	defaultDiscoveryExpire   = 15 * time.Minute
+	defaultTLSCAFile         = ""
+	defaultTLSCertFile       = ""
+	defaultTLSKeyFile        = ""
+	defaultTLSServerName     = ""
+	defaultTLSInsecure       = false
 )
 
 type Config struct {
@@ -33,22 +70,64 @@ type Config struct {
 	UDPServer  UDPServer
 	Serial     Serial
 	MQTT       MQTT
+	Storage    Storage
+	Dataset    Dataset
+	Auth       Auth
+	Ingest     Ingest
+	Capture    Capture
+}
+
+type Ingest struct {
+	DedupWindow time.Duration
+}
+
+type Capture struct {
+	// File receives the raw frames of every source, empty records nothing.
+	File string
 }
 
 type HTTPServer struct {
 	Addr string
+	// ImportToken is the bearer token imports over HTTP need, empty turns
+	// them off.
+	ImportToken string
 }
 
 type UDPServer struct {
-	Enable bool
-	Port   string
+	Enable     bool
+	Port       string
+	Quarantine string
+	Decoders   []string
 }
 
 type Serial struct {
-	Enable   bool
-	PortName string
+	Enable bool
+	// Ports are device paths, glob patterns or usb:VID[:PID], every matching
+	// port is read while it is present.
+	Ports        []string
+	ScanInterval time.Duration
+	// RetryMin and RetryMax bound the delay before a port that failed is
+	// opened again.
+	RetryMin time.Duration
+	RetryMax time.Duration
 	BaudRate int
 	Tag      string
+	Decoders []string
+	// Names maps sender MACs of the extended log format to device ids.
+	Names map[string]string
+}
+
+type Storage struct {
+	DataDir string
+}
+
+type Dataset struct {
+	Location            *time.Location
+	Periods             []Period
+	RawRetention        time.Duration
+	FiveMinuteRetention time.Duration
+	HourRetention       time.Duration
+	DayRetention        time.Duration
 }
 
 type MQTT struct {
@@ -59,7 +138,58 @@ type MQTT struct {
 	Username          string
 	Password          string
 	PingTimeout       time.Duration
-	Topic             string
+	// RetryMin and RetryMax bound the delay between connection attempts.
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// CleanSession drops the subscriptions and queued messages the broker
+	// keeps for ClientID while the service is down.
+	CleanSession bool
+	// Topic, DeviceSegment, Decoders and JSONFields are the defaults of
+	// every subscription, Topic alone is used without subscriptions.
+	Topic         string
+	DeviceSegment int
+	Decoders      []string
+	JSONFields    string
+	Subscriptions []Subscription
+	TLS           TLS
+	Publish       Publish
+	Discovery     Discovery
+}
+
+// Discovery announces every device to Home Assistant, its entities read the
+// published readings.
+type Discovery struct {
+	Enable bool
+	Prefix string
+	// Expire marks a device unavailable after this long without a reading.
+	Expire time.Duration
+}
+
+// Publish sends every decoded reading back to the broker as JSON.
+type Publish struct {
+	// Topic has {device} replaced by the device id, empty disables publishing.
+	Topic  string
+	QoS    int
+	Retain bool
+}
+
+// TLS configures the connection to an ssl://, tls://, mqtts:// or tcps://
+// broker.
+type TLS struct {
+	// CAFile is a PEM bundle of the CAs the broker certificate is checked
+	// against, the system pool when empty.
+	CAFile   string
+	CertFile string
+	KeyFile  string
+	// ServerName overrides the host name the broker certificate is checked
+	// against.
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// Configured reports whether any TLS option is set.
+func (t TLS) Configured() bool {
+	return t != TLS{}
 }
 
 func FromFlags() Config {
@@ -69,25 +199,146 @@ func FromFlags() Config {
 	flag.BoolVar(&cfg.Debug, "app-debug", false, "enable debug mode")
 
 	flag.StringVar(&cfg.HTTPServer.Addr, "http-addr", defaultHTTPAddr, "HTTP server address")
+	flag.StringVar(&cfg.HTTPServer.ImportToken, "http-import-token", defaultImportToken,
+		"bearer token POST /api/v1/import requires (empty disables imports over HTTP)")
 
 	flag.BoolVar(&cfg.UDPServer.Enable, "udp-enable", defaultEnableUDP, "enable UDP server")
 	flag.StringVar(&cfg.UDPServer.Port, "udp-port", defaultUDPPort, "UDP server port")
+	flag.StringVar(&cfg.UDPServer.Quarantine, "udp-quarantine", defaultUDPQuarantine,
+		"file to append malformed UDP datagrams to (empty drops them)")
+	decodersFlag(flag.CommandLine, &cfg.UDPServer.Decoders, "udp-decoders", defaultUDPDecoders)
 
 	flag.BoolVar(&cfg.Serial.Enable, "serial-enable", defaultEnableSerial, "enable serial client")
-	flag.StringVar(&cfg.Serial.PortName, "serial-port", defaultDevice, "serial device path (e.g., /dev/ttyUSB0)")
+	_ = listValue{&cfg.Serial.Ports}.Set(defaultDevice)
+	flag.Var(listValue{&cfg.Serial.Ports}, "serial-port",
+		"comma separated serial device paths, globs (e.g., /dev/ttyACM*) or usb:VID[:PID] (e.g., usb:303a:1001)")
+	flag.DurationVar(&cfg.Serial.ScanInterval, "serial-scan-interval", defaultScanInterval,
+		"how often to look for serial ports that appeared")
+	flag.DurationVar(&cfg.Serial.RetryMin, "serial-retry-min", defaultSerialRetryMin,
+		"first delay before a serial port that failed is opened again")
+	flag.DurationVar(&cfg.Serial.RetryMax, "serial-retry-max", defaultSerialRetryMax,
+		"delay before a failing serial port is opened again doubles up to this")
 	flag.IntVar(&cfg.Serial.BaudRate, "serial-baud", defaultBaudRate, "serial baud rate")
 	flag.StringVar(&cfg.Serial.Tag, "serial-tag", defaultDeviceTag, "device tag identifier")
+	decodersFlag(flag.CommandLine, &cfg.Serial.Decoders, "serial-decoders", defaultSerialDecoders)
+	flag.Var(namesValue{&cfg.Serial.Names}, "serial-names",
+		"comma separated MAC=name pairs naming the senders of serial log lines")
+
+	flag.StringVar(&cfg.Storage.DataDir, "data-dir", defaultDataDir,
+		"directory for persistent history (empty keeps history in memory)")
+
+	datasetFromFlags(flag.CommandLine, &cfg.Dataset)
+
+	flag.StringVar(&cfg.Auth.KeysFile, "auth-keys", defaultAuthKeys,
+		"file of device=hexkey lines, UDP and MQTT packets must then be authenticated")
+	flag.DurationVar(&cfg.Ingest.DedupWindow, "dedup-window", defaultDedupWindow,
+		"drop copies of a packet received within this window (0 disables)")
+	flag.StringVar(&cfg.Capture.File, "capture", defaultCaptureFile,
+		"file to append the raw frames of every source to, for the replay command (empty records nothing)")
 
 	flag.BoolVar(&cfg.MQTT.Enable, "mqtt-enable", defaultEnableMQTT, "enable MQTT client")
 	flag.StringVar(&cfg.MQTT.Broker, "mqtt-broker", defaultBroker, "MQTT broker URI")
-	flag.StringVar(&cfg.MQTT.ClientID, "mqtt-client-id", defaultClientID, "MQTT client id")
+	flag.StringVar(&cfg.MQTT.ClientID, "mqtt-client-id", defaultClientID,
+		"MQTT client id, the broker keeps the session by it (empty uses the host name)")
 	flag.DurationVar(&cfg.MQTT.KeepAliveDuration, "mqtt-keep-alive", defaultKeepAliveDuration, "MQTT keep alive duration")
 	flag.DurationVar(&cfg.MQTT.PingTimeout, "mqtt-ping-timeout", defaultPingTimeout, "MQTT ping timeout")
+	flag.DurationVar(&cfg.MQTT.RetryMin, "mqtt-retry-min", defaultRetryMin, "first delay between MQTT connection attempts")
+	flag.DurationVar(&cfg.MQTT.RetryMax, "mqtt-retry-max", defaultRetryMax,
+		"delay between MQTT connection attempts doubles up to this")
+	flag.BoolVar(&cfg.MQTT.CleanSession, "mqtt-clean-session", defaultCleanSession,
+		"start a new MQTT session on every connect, messages sent while disconnected are lost")
 	flag.StringVar(&cfg.MQTT.Username, "mqtt-username", defaultUsername, "MQTT username")
 	flag.StringVar(&cfg.MQTT.Password, "mqtt-password", defaultPassword, "MQTT password")
-	flag.StringVar(&cfg.MQTT.Topic, "mqtt-topic", defaultTopic, "MQTT topic")
+	flag.StringVar(&cfg.MQTT.Topic, "mqtt-topic", defaultTopic, "MQTT topic, used without -mqtt-subscription")
+	flag.IntVar(&cfg.MQTT.DeviceSegment, "mqtt-device-segment", defaultDeviceSegment,
+		"MQTT topic segment used as device id (negative counts from the end)")
+	decodersFlag(flag.CommandLine, &cfg.MQTT.Decoders, "mqtt-decoders", defaultMQTTDecoders)
+	flag.StringVar(&cfg.MQTT.JSONFields, "mqtt-json-fields", defaultMQTTJSONFields,
+		"comma separated metric=path[:unit] mapping of JSON payloads for the json decoder")
+	flag.Var(subscriptionsValue{&cfg.MQTT.Subscriptions}, "mqtt-subscription",
+		"repeatable topic[;qos=N;decoders=a,b;device-segment=N;json-fields=...], "+
+			"omitted options default to the -mqtt-* flags")
+	tlsFromFlags(flag.CommandLine, &cfg.MQTT.TLS)
+	publishFromFlags(flag.CommandLine, &cfg.MQTT.Publish)
+	discoveryFromFlags(flag.CommandLine, &cfg.MQTT.Discovery)
 
 	flag.Parse()
 
+	cfg.MQTT.Subscriptions = subscriptions(cfg.MQTT)
+
 	return cfg
 }
+
+// subscriptions completes the configured subscriptions, -mqtt-topic stands
+// in when there are none.
+func subscriptions(cfg MQTT) []Subscription {
+	defaults := Subscription{
+		Topic:         cfg.Topic,
+		Decoders:      cfg.Decoders,
+		DeviceSegment: cfg.DeviceSegment,
+		JSONFields:    cfg.JSONFields,
+	}
+
+	if len(cfg.Subscriptions) == 0 {
+		return []Subscription{defaults}
+	}
+
+	subs := make([]Subscription, 0, len(cfg.Subscriptions))
+	for _, s := range cfg.Subscriptions {
+		subs = append(subs, s.withDefaults(defaults))
+	}
+
+	return subs
+}
+
+// decodersFlag registers a source's list of packet decoders, tried in order.
+func decodersFlag(fs *flag.FlagSet, decoders *[]string, name, value string) {
+	_ = listValue{decoders}.Set(value)
+
+	fs.Var(listValue{decoders}, name, "comma separated packet decoders tried in order")
+}
+
+func tlsFromFlags(fs *flag.FlagSet, cfg *TLS) {
+	fs.StringVar(&cfg.CAFile, "mqtt-tls-ca", defaultTLSCAFile,
+		"PEM file of the CAs the MQTT broker certificate is checked against (empty uses the system CAs)")
+	fs.StringVar(&cfg.CertFile, "mqtt-tls-cert", defaultTLSCertFile, "PEM client certificate for the MQTT broker")
+	fs.StringVar(&cfg.KeyFile, "mqtt-tls-key", defaultTLSKeyFile, "PEM key of -mqtt-tls-cert")
+	fs.StringVar(&cfg.ServerName, "mqtt-tls-server-name", defaultTLSServerName,
+		"name the MQTT broker certificate is checked against (empty uses the broker host)")
+	fs.BoolVar(&cfg.InsecureSkipVerify, "mqtt-tls-insecure", defaultTLSInsecure,
+		"skip checking the MQTT broker certificate")
+}
+
+func publishFromFlags(fs *flag.FlagSet, cfg *Publish) {
+	fs.StringVar(&cfg.Topic, "mqtt-publish-topic", defaultPublishTopic,
+		"MQTT topic every decoded reading is published to as JSON, {device} is the device id (empty publishes nothing)")
+	fs.IntVar(&cfg.QoS, "mqtt-publish-qos", defaultPublishQoS, "QoS of published readings")
+	fs.BoolVar(&cfg.Retain, "mqtt-publish-retain", defaultPublishRetain, "retain the last published reading per device")
+}
+
+func discoveryFromFlags(fs *flag.FlagSet, cfg *Discovery) {
+	fs.BoolVar(&cfg.Enable, "mqtt-discovery", defaultDiscovery,
+		"announce devices to Home Assistant, needs {device} in -mqtt-publish-topic")
+	fs.StringVar(&cfg.Prefix, "mqtt-discovery-prefix", defaultDiscoveryPrefix, "Home Assistant discovery topic prefix")
+	fs.DurationVar(&cfg.Expire, "mqtt-discovery-expire", defaultDiscoveryExpire,
+		"mark a device unavailable after this long without a reading")
+}
+
+func datasetFromFlags(fs *flag.FlagSet, cfg *Dataset) {
+	cfg.Location = time.Local
+	cfg.Periods, _ = ParsePeriods(defaultPeriods)
+
+	fs.Var(locationValue{&cfg.Location}, "timezone",
+		"IANA time zone used to split readings into days and periods (default local)")
+	fs.Var(periodsValue{&cfg.Periods}, "day-periods",
+		"comma separated day periods as name=HH:MM[@HH:MM], the optional part is the chart position")
+
+	fs.DurationVar(&cfg.RawRetention, "history-raw-retention", defaultRawRetention,
+		"how long raw readings are kept")
+	fs.DurationVar(&cfg.FiveMinuteRetention, "history-5m-retention", defaultFiveMinuteRetention,
+		"how long 5-minute aggregates are kept")
+	fs.DurationVar(&cfg.HourRetention, "history-1h-retention", defaultHourRetention,
+		"how long hourly aggregates are kept")
+	fs.DurationVar(&cfg.DayRetention, "history-1d-retention", defaultDayRetention,
+		"how long daily aggregates are kept")
+}
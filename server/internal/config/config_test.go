@@ -0,0 +1,66 @@
+package config //nolint:testpackage
+
+import (
+	"flag"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTLSFromFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var cfg TLS
+
+	tlsFromFlags(fs, &cfg)
+	require.NoError(t, fs.Parse(nil))
+	assert.False(t, cfg.Configured())
+
+	require.NoError(t, fs.Parse([]string{
+		"-mqtt-tls-ca=ca.pem",
+		"-mqtt-tls-cert=client.pem",
+		"-mqtt-tls-key=client.key",
+		"-mqtt-tls-server-name=mosquitto.lan",
+		"-mqtt-tls-insecure",
+	}))
+	assert.Equal(t, TLS{
+		CAFile:             "ca.pem",
+		CertFile:           "client.pem",
+		KeyFile:            "client.key",
+		ServerName:         "mosquitto.lan",
+		InsecureSkipVerify: true,
+	}, cfg)
+}
+
+func TestPublishFromFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var cfg Publish
+
+	publishFromFlags(fs, &cfg)
+	require.NoError(t, fs.Parse(nil))
+	assert.Equal(t, Publish{Retain: true}, cfg)
+
+	require.NoError(t, fs.Parse([]string{
+		"-mqtt-publish-topic=sensors/{device}/state",
+		"-mqtt-publish-qos=1",
+		"-mqtt-publish-retain=false",
+	}))
+	assert.Equal(t, Publish{Topic: "sensors/{device}/state", QoS: 1}, cfg)
+}
+
+func TestDiscoveryFromFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+
+	var cfg Discovery
+
+	discoveryFromFlags(fs, &cfg)
+	require.NoError(t, fs.Parse([]string{
+		"-mqtt-discovery",
+		"-mqtt-discovery-prefix=ha",
+		"-mqtt-discovery-expire=5m",
+	}))
+	assert.Equal(t, Discovery{Enable: true, Prefix: "ha", Expire: 5 * time.Minute}, cfg)
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"flag"
+	"time"
+)
+
+const (
+	defaultExportFormat          = "csv"
+	defaultExportPressureUnit    = "mmhg"
+	defaultExportTemperatureUnit = "c"
+	defaultExportOutput          = "-"
+)
+
+// Export configures the export subcommand.
+type Export struct {
+	DataDir         string
+	Output          string
+	Format          string
+	Device          string
+	From            time.Time
+	To              time.Time
+	PressureUnit    string
+	TemperatureUnit string
+}
+
+func ExportFromFlags(args []string) (Export, error) {
+	cfg := Export{}
+
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "directory with persistent history")
+	fs.StringVar(&cfg.Output, "output", defaultExportOutput, "output file, - for stdout")
+	fs.StringVar(&cfg.Format, "format", defaultExportFormat, "output format: csv or ndjson")
+	fs.StringVar(&cfg.Device, "device", "", "export a single device")
+	fs.Var(timeValue{&cfg.From}, "from", "export readings since, RFC 3339 or unix milliseconds")
+	fs.Var(timeValue{&cfg.To}, "to", "export readings until, RFC 3339 or unix milliseconds")
+	fs.StringVar(&cfg.PressureUnit, "pressure-unit", defaultExportPressureUnit, "pressure unit: mmhg or hpa")
+	fs.StringVar(&cfg.TemperatureUnit, "temperature-unit", defaultExportTemperatureUnit, "temperature unit: c or f")
+
+	if err := fs.Parse(args); err != nil {
+		return Export{}, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"flag"
+)
+
+const (
+	defaultImportFormat = "csv"
+	defaultImportInput  = "-"
+)
+
+// Import configures the import subcommand.
+type Import struct {
+	DataDir string
+	Input   string
+	Format  string
+	Device  string
+	// Dataset decides which readings are too old to keep.
+	Dataset Dataset
+}
+
+func ImportFromFlags(args []string) (Import, error) {
+	cfg := Import{}
+
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "directory with persistent history")
+	fs.StringVar(&cfg.Input, "input", defaultImportInput, "input file, - for stdin")
+	fs.StringVar(&cfg.Format, "format", defaultImportFormat, "input format: csv or ndjson")
+	fs.StringVar(&cfg.Device, "device", "", "device of readings without a device column (default device if empty)")
+
+	datasetFromFlags(fs, &cfg.Dataset)
+
+	if err := fs.Parse(args); err != nil {
+		return Import{}, err
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,30 @@
+package config
+
+import "strings"
+
+// listValue is a comma separated flag value.
+type listValue struct {
+	items *[]string
+}
+
+func (v listValue) String() string {
+	if v.items == nil {
+		return ""
+	}
+
+	return strings.Join(*v.items, ",")
+}
+
+func (v listValue) Set(s string) error {
+	items := make([]string, 0, strings.Count(s, ",")+1)
+
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	*v.items = items
+
+	return nil
+}
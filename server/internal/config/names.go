@@ -0,0 +1,69 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+)
+
+var errInvalidName = errors.New("invalid device name, want MAC=name")
+
+// ParseNames parses comma separated MAC=name pairs like
+// "24:0A:C4:12:34:56=balcony", MACs are returned upper case with colons.
+func ParseNames(s string) (map[string]string, error) {
+	names := make(map[string]string)
+
+	for pair := range strings.SplitSeq(s, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		mac, name, ok := strings.Cut(pair, "=")
+		name = strings.TrimSpace(name)
+
+		if !ok || name == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidName, pair)
+		}
+
+		addr, err := net.ParseMAC(strings.TrimSpace(mac))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", errInvalidName, pair, err)
+		}
+
+		names[strings.ToUpper(addr.String())] = name
+	}
+
+	return names, nil
+}
+
+// namesValue is a flag of MAC=name pairs.
+type namesValue struct {
+	names *map[string]string
+}
+
+func (v namesValue) String() string {
+	if v.names == nil {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(*v.names))
+	for _, mac := range slices.Sorted(maps.Keys(*v.names)) {
+		pairs = append(pairs, mac+"="+(*v.names)[mac])
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (v namesValue) Set(s string) error {
+	names, err := ParseNames(s)
+	if err != nil {
+		return err
+	}
+
+	*v.names = names
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package config //nolint:testpackage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNames(t *testing.T) {
+	names, err := ParseNames("24:0a:c4:12:34:56=balcony, 24-0A-C4-AB-CD-EF = bedroom")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"24:0A:C4:12:34:56": "balcony",
+		"24:0A:C4:AB:CD:EF": "bedroom",
+	}, names)
+
+	assert.Equal(t, "24:0A:C4:12:34:56=balcony,24:0A:C4:AB:CD:EF=bedroom", namesValue{&names}.String())
+
+	for _, s := range []string{"24:0a:c4:12:34:56", "24:0a:c4:12:34:56=", "kitchen=balcony"} {
+		_, err := ParseNames(s)
+		require.ErrorIs(t, err, errInvalidName, s)
+	}
+}
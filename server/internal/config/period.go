@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultPeriods keeps the historic morning/day/evening split of the chart.
+const defaultPeriods = "morning=06:00@08:00,day=14:00@14:00,evening=19:00@19:00"
+
+var (
+	errInvalidPeriod    = errors.New("invalid day period")
+	errPeriodsUnordered = errors.New("day periods must start in ascending order")
+	errNoPeriods        = errors.New("at least one day period is required")
+)
+
+// Period is a named part of the day. It lasts from Start until the Start of
+// the next period, the last one wraps around midnight. Plot is where the
+// period average is placed on the chart. Both are offsets from midnight.
+type Period struct {
+	Name  string
+	Start time.Duration
+	Plot  time.Duration
+}
+
+func (p Period) String() string {
+	return p.Name + "=" + formatClock(p.Start) + "@" + formatClock(p.Plot)
+}
+
+// ParsePeriods parses a comma separated list of name=HH:MM[@HH:MM] entries,
+// the plot time defaults to the start of the period.
+func ParsePeriods(s string) ([]Period, error) {
+	periods := make([]Period, 0, strings.Count(s, ",")+1)
+
+	for entry := range strings.SplitSeq(s, ",") {
+		period, err := parsePeriod(strings.TrimSpace(entry))
+		if err != nil {
+			return nil, err
+		}
+
+		if n := len(periods); n > 0 && periods[n-1].Start >= period.Start {
+			return nil, fmt.Errorf("%w: %q", errPeriodsUnordered, entry)
+		}
+
+		periods = append(periods, period)
+	}
+
+	if len(periods) == 0 {
+		return nil, errNoPeriods
+	}
+
+	return periods, nil
+}
+
+func parsePeriod(entry string) (Period, error) {
+	name, clock, ok := strings.Cut(entry, "=")
+	if !ok || name == "" {
+		return Period{}, fmt.Errorf("%w: %q", errInvalidPeriod, entry)
+	}
+
+	start, plot, hasPlot := strings.Cut(clock, "@")
+	if !hasPlot {
+		plot = start
+	}
+
+	startOffset, err := parseClock(start)
+	if err != nil {
+		return Period{}, fmt.Errorf("%w: %q: %w", errInvalidPeriod, entry, err)
+	}
+
+	plotOffset, err := parseClock(plot)
+	if err != nil {
+		return Period{}, fmt.Errorf("%w: %q: %w", errInvalidPeriod, entry, err)
+	}
+
+	return Period{
+		Name:  name,
+		Start: startOffset,
+		Plot:  plotOffset,
+	}, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+type periodsValue struct {
+	periods *[]Period
+}
+
+func (v periodsValue) String() string {
+	if v.periods == nil {
+		return ""
+	}
+
+	entries := make([]string, 0, len(*v.periods))
+	for _, p := range *v.periods {
+		entries = append(entries, p.String())
+	}
+
+	return strings.Join(entries, ",")
+}
+
+func (v periodsValue) Set(s string) error {
+	periods, err := ParsePeriods(s)
+	if err != nil {
+		return err
+	}
+
+	*v.periods = periods
+
+	return nil
+}
+
+type locationValue struct {
+	location **time.Location
+}
+
+func (v locationValue) String() string {
+	if v.location == nil || *v.location == nil {
+		return ""
+	}
+
+	return (*v.location).String()
+}
+
+func (v locationValue) Set(s string) error {
+	location, err := time.LoadLocation(s)
+	if err != nil {
+		return err
+	}
+
+	*v.location = location
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package config_test
+
+import (
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePeriods(t *testing.T) {
+	periods, err := config.ParsePeriods("morning=06:00@08:00, day=14:00,evening=19:30@20:15")
+	require.NoError(t, err)
+
+	assert.Equal(t, []config.Period{
+		{Name: "morning", Start: 6 * time.Hour, Plot: 8 * time.Hour},
+		{Name: "day", Start: 14 * time.Hour, Plot: 14 * time.Hour},
+		{Name: "evening", Start: 19*time.Hour + 30*time.Minute, Plot: 20*time.Hour + 15*time.Minute},
+	}, periods)
+
+	assert.Equal(t, "evening=19:30@20:15", periods[2].String())
+}
+
+func TestParsePeriodsInvalid(t *testing.T) {
+	tests := []string{
+		"",
+		"morning",
+		"=06:00",
+		"morning=6",
+		"morning=25:00",
+		"morning=06:00@noon",
+		"day=14:00,morning=06:00",
+		"morning=06:00,again=06:00",
+	}
+
+	for _, test := range tests {
+		_, err := config.ParsePeriods(test)
+		assert.Error(t, err, "input: %q", test)
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"flag"
+	"time"
+)
+
+const (
+	defaultReplayInput  = "-"
+	defaultReplayOutput = "-"
+	defaultReplayFormat = "ndjson"
+	defaultReplaySpeed  = 1
+)
+
+// Replay configures the replay subcommand, the decoder flags match the
+// service's so a capture decodes as it did when it was recorded.
+type Replay struct {
+	Input  string
+	Output string
+	Format string
+	// Speed divides the recorded gaps between frames, 0 does not wait.
+	Speed          float64
+	UDPDecoders    []string
+	SerialDecoders []string
+	SerialTag      string
+	SerialNames    map[string]string
+	MQTTDecoders   []string
+	JSONFields     string
+	Auth           Auth
+	DedupWindow    time.Duration
+}
+
+func ReplayFromFlags(args []string) (Replay, error) {
+	cfg := Replay{}
+
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.Input, "input", defaultReplayInput, "capture file, - for stdin")
+	fs.StringVar(&cfg.Output, "output", defaultReplayOutput, "file for the decoded readings, - for stdout")
+	fs.StringVar(&cfg.Format, "format", defaultReplayFormat, "output format: csv or ndjson")
+	fs.Float64Var(&cfg.Speed, "speed", defaultReplaySpeed,
+		"replay speed, 1 as recorded, 10 ten times faster, 0 without waiting")
+	decodersFlag(fs, &cfg.UDPDecoders, "udp-decoders", defaultUDPDecoders)
+	decodersFlag(fs, &cfg.SerialDecoders, "serial-decoders", defaultSerialDecoders)
+	fs.StringVar(&cfg.SerialTag, "serial-tag", defaultDeviceTag, "device tag identifier")
+	fs.Var(namesValue{&cfg.SerialNames}, "serial-names",
+		"comma separated MAC=name pairs naming the senders of serial log lines")
+	decodersFlag(fs, &cfg.MQTTDecoders, "mqtt-decoders", defaultMQTTDecoders)
+	fs.StringVar(&cfg.JSONFields, "mqtt-json-fields", defaultMQTTJSONFields,
+		"comma separated metric=path[:unit] mapping of JSON payloads for the json decoder")
+	fs.StringVar(&cfg.Auth.KeysFile, "auth-keys", defaultAuthKeys,
+		"file of device=hexkey lines, UDP and MQTT packets must then be authenticated")
+	fs.DurationVar(&cfg.DedupWindow, "dedup-window", defaultDedupWindow,
+		"drop copies of a packet received within this window (0 disables)")
+
+	if err := fs.Parse(args); err != nil {
+		return Replay{}, err
+	}
+
+	return cfg, nil
+}
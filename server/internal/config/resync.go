@@ -0,0 +1,26 @@
+package config
+
+import (
+	"flag"
+)
+
+// Resync configures the resync subcommand.
+type Resync struct {
+	DataDir string
+	Device  string
+}
+
+func ResyncFromFlags(args []string) (Resync, error) {
+	cfg := Resync{}
+
+	fs := flag.NewFlagSet("resync", flag.ContinueOnError)
+
+	fs.StringVar(&cfg.DataDir, "data-dir", defaultDataDir, "directory with persistent history")
+	fs.StringVar(&cfg.Device, "device", "", "device whose authentication counter starts over")
+
+	if err := fs.Parse(args); err != nil {
+		return Resync{}, err
+	}
+
+	return cfg, nil
+}
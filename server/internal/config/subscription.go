@@ -0,0 +1,153 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	subscriptionQoS           = "qos"
+	subscriptionDecoders      = "decoders"
+	subscriptionDeviceSegment = "device-segment"
+	subscriptionJSONFields    = "json-fields"
+
+	maxQoS = 2
+)
+
+var (
+	errInvalidSubscription = errors.New("invalid subscription, want topic[;key=value...]")
+	errUnknownOption       = errors.New("unknown subscription option")
+)
+
+// Subscription is one MQTT topic filter with its own decoding rules.
+type Subscription struct {
+	Topic         string
+	QoS           byte
+	Decoders      []string
+	DeviceSegment int
+	JSONFields    string
+
+	// set holds the options given explicitly, the others come from the
+	// -mqtt-* flags.
+	set map[string]bool
+}
+
+// ParseSubscription parses topic[;key=value...] with the keys qos,
+// decoders, device-segment and json-fields, e.g.
+// "zigbee2mqtt/+;qos=1;decoders=json;device-segment=1".
+func ParseSubscription(s string) (Subscription, error) {
+	topic, options, _ := strings.Cut(s, ";")
+
+	sub := Subscription{
+		Topic: strings.TrimSpace(topic),
+		set:   make(map[string]bool),
+	}
+
+	if sub.Topic == "" {
+		return Subscription{}, fmt.Errorf("%w: %q", errInvalidSubscription, s)
+	}
+
+	for option := range strings.SplitSeq(options, ";") {
+		if strings.TrimSpace(option) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			return Subscription{}, fmt.Errorf("%w: %q", errInvalidSubscription, option)
+		}
+
+		key = strings.TrimSpace(key)
+		if err := sub.setOption(key, strings.TrimSpace(value)); err != nil {
+			return Subscription{}, fmt.Errorf("%s: %w", key, err)
+		}
+
+		sub.set[key] = true
+	}
+
+	return sub, nil
+}
+
+func (s *Subscription) setOption(key, value string) error {
+	switch key {
+	case subscriptionQoS:
+		qos, err := strconv.ParseUint(value, 10, 8)
+		if err != nil || qos > maxQoS {
+			return fmt.Errorf("%w: %q, want 0, 1 or 2", errInvalidSubscription, value)
+		}
+
+		s.QoS = byte(qos)
+	case subscriptionDecoders:
+		return listValue{&s.Decoders}.Set(value)
+	case subscriptionDeviceSegment:
+		segment, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+
+		s.DeviceSegment = segment
+	case subscriptionJSONFields:
+		s.JSONFields = value
+	default:
+		return fmt.Errorf("%w: %s", errUnknownOption, key)
+	}
+
+	return nil
+}
+
+// withDefaults fills the options not given explicitly from d.
+func (s Subscription) withDefaults(d Subscription) Subscription {
+	if !s.set[subscriptionQoS] {
+		s.QoS = d.QoS
+	}
+
+	if !s.set[subscriptionDecoders] {
+		s.Decoders = d.Decoders
+	}
+
+	if !s.set[subscriptionDeviceSegment] {
+		s.DeviceSegment = d.DeviceSegment
+	}
+
+	if !s.set[subscriptionJSONFields] {
+		s.JSONFields = d.JSONFields
+	}
+
+	return s
+}
+
+func (s Subscription) String() string {
+	return fmt.Sprintf("%s;qos=%d;decoders=%s;device-segment=%d",
+		s.Topic, s.QoS, strings.Join(s.Decoders, ","), s.DeviceSegment)
+}
+
+// subscriptionsValue is a repeatable flag.
+type subscriptionsValue struct {
+	subscriptions *[]Subscription
+}
+
+func (v subscriptionsValue) String() string {
+	if v.subscriptions == nil {
+		return ""
+	}
+
+	entries := make([]string, 0, len(*v.subscriptions))
+	for _, s := range *v.subscriptions {
+		entries = append(entries, s.String())
+	}
+
+	return strings.Join(entries, " ")
+}
+
+func (v subscriptionsValue) Set(s string) error {
+	sub, err := ParseSubscription(s)
+	if err != nil {
+		return err
+	}
+
+	*v.subscriptions = append(*v.subscriptions, sub)
+
+	return nil
+}
@@ -0,0 +1,59 @@
+package config //nolint:testpackage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSubscription(t *testing.T) {
+	sub, err := ParseSubscription("zigbee2mqtt/+; qos=1; decoders=json,espnow-frame; device-segment=1")
+	require.NoError(t, err)
+
+	assert.Equal(t, "zigbee2mqtt/+", sub.Topic)
+	assert.Equal(t, byte(1), sub.QoS)
+	assert.Equal(t, []string{"json", "espnow-frame"}, sub.Decoders)
+	assert.Equal(t, 1, sub.DeviceSegment)
+
+	tests := map[string]string{
+		"":                    "invalid subscription",
+		";qos=1":              "invalid subscription",
+		"a/b;qos":             "invalid subscription",
+		"a/b;qos=3":           "invalid subscription",
+		"a/b;device-segment=": "device-segment",
+		"a/b;retain=1":        "unknown subscription option",
+	}
+
+	for input, expected := range tests {
+		_, err := ParseSubscription(input)
+		require.ErrorContains(t, err, expected, "input: %q", input)
+	}
+}
+
+func TestSubscriptionsDefaults(t *testing.T) {
+	cfg := MQTT{
+		Topic:         "espnow/+",
+		DeviceSegment: -1,
+		Decoders:      []string{"espnow-frame"},
+		JSONFields:    "temperature=temperature",
+	}
+
+	assert.Equal(t, []Subscription{{
+		Topic:         "espnow/+",
+		Decoders:      []string{"espnow-frame"},
+		DeviceSegment: -1,
+		JSONFields:    "temperature=temperature",
+	}}, subscriptions(cfg))
+
+	for _, s := range []string{"tele/+/SENSOR;decoders=json;device-segment=1;qos=1", "espnow/#"} {
+		require.NoError(t, subscriptionsValue{&cfg.Subscriptions}.Set(s))
+	}
+
+	subs := subscriptions(cfg)
+	require.Len(t, subs, 2)
+
+	assert.Equal(t, "tele/+/SENSOR;qos=1;decoders=json;device-segment=1", subs[0].String())
+	assert.Equal(t, "temperature=temperature", subs[0].JSONFields)
+	assert.Equal(t, "espnow/#;qos=0;decoders=espnow-frame;device-segment=-1", subs[1].String())
+}
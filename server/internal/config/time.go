@@ -0,0 +1,51 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var errInvalidTime = errors.New("invalid time, use RFC 3339 or unix milliseconds")
+
+// ParseTime accepts RFC 3339 or unix milliseconds, an empty value is the zero time.
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if millis, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(millis), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%w: %s", errInvalidTime, value)
+	}
+
+	return t, nil
+}
+
+type timeValue struct {
+	time *time.Time
+}
+
+func (v timeValue) String() string {
+	if v.time == nil || v.time.IsZero() {
+		return ""
+	}
+
+	return v.time.Format(time.RFC3339)
+}
+
+func (v timeValue) Set(s string) error {
+	t, err := ParseTime(s)
+	if err != nil {
+		return err
+	}
+
+	*v.time = t
+
+	return nil
+}
@@ -5,50 +5,84 @@ import (
 	"slices"
 	"sync"
 	"time"
+
+	"temperature-sensor/internal/config"
 )
 
-type aggregatedData struct {
-	morningSum,
-	daySum,
-	eveningSum,
-	morningCount,
-	dayCount,
-	eveningCount float32
+type periodData struct {
+	sum,
+	count float32
+	min,
+	max Extreme
+}
+
+func (p *periodData) add(value float32, timestamp int64) {
+	if p.count == 0 || value < p.min.Value {
+		p.min = Extreme{Value: value, Timestamp: timestamp}
+	}
+
+	if p.count == 0 || value > p.max.Value {
+		p.max = Extreme{Value: value, Timestamp: timestamp}
+	}
+
+	p.sum += value
+	p.count++
 }
 
+// aggregatedData holds one entry per configured day period.
+type aggregatedData []periodData
+
 type dailyAggregatedData map[int64]aggregatedData
 
 type setOfData struct {
-	data dailyAggregatedData
-	mu   sync.RWMutex
+	data     dailyAggregatedData
+	periods  []config.Period
+	location *time.Location
+	mu       sync.RWMutex
+}
+
+// beginningOfDay returns local midnight, which is not always 24h after the
+// previous one.
+func beginningOfDay(timestamp time.Time, location *time.Location) time.Time {
+	year, month, day := timestamp.In(location).Date()
+
+	return time.Date(year, month, day, 0, 0, 0, 0, location)
+}
+
+func clockOffset(timestamp time.Time, location *time.Location) time.Duration {
+	hour, minute, sec := timestamp.In(location).Clock()
+
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(sec)*time.Second
+}
+
+// periodIndex returns the period the clock offset falls in. Offsets before
+// the first period belong to the last one, as it wraps around midnight.
+func periodIndex(periods []config.Period, offset time.Duration) int {
+	index := len(periods) - 1
+
+	for i, period := range periods {
+		if offset >= period.Start {
+			index = i
+		}
+	}
+
+	return index
 }
 
 func (d *setOfData) push(value float32, timestamp time.Time) {
-	bod := timestamp.Truncate(24 * time.Hour).UnixMilli()
-	hour := timestamp.Hour()
+	bod := beginningOfDay(timestamp, d.location).UnixMilli()
+	index := periodIndex(d.periods, clockOffset(timestamp, d.location))
 
 	d.mu.Lock()
 	defer d.mu.Unlock()
 
-	if _, exists := d.data[bod]; !exists {
-		d.data[bod] = aggregatedData{}
+	dayData, exists := d.data[bod]
+	if !exists {
+		dayData = make(aggregatedData, len(d.periods))
+		d.data[bod] = dayData
 	}
 
-	dayData := d.data[bod]
-
-	switch {
-	case hour >= 6 && hour < 14:
-		dayData.morningSum += value
-		dayData.morningCount++
-	case hour >= 14 && hour < 19:
-		dayData.daySum += value
-		dayData.dayCount++
-	case hour >= 19 || hour < 6:
-		dayData.eveningSum += value
-		dayData.eveningCount++
-	}
-
-	d.data[bod] = dayData
+	dayData[index].add(value, timestamp.UnixMilli())
 }
 
 func (d *setOfData) remove(before time.Time) {
@@ -64,9 +98,11 @@ func (d *setOfData) remove(before time.Time) {
 	}
 }
 
-func newSetOfData() *setOfData {
+func newSetOfData(cfg config.Dataset) *setOfData {
 	return &setOfData{
-		data: make(dailyAggregatedData),
+		data:     make(dailyAggregatedData),
+		periods:  cfg.Periods,
+		location: cfg.Location,
 	}
 }
 
@@ -77,12 +113,8 @@ func toFixed(v float32) float32 {
 	return float32(math.Round(float64(v*100)) / 100)
 }
 
-func (d *setOfData) timeSeries() timeSeries {
-	d.mu.RLock()
-	defer d.mu.RUnlock()
-
-	series := make(timeSeries, 0, len(d.data)*3)
-
+// days returns the sorted beginnings of the stored days, the caller holds the lock.
+func (d *setOfData) days() []int64 {
 	timestamps := make([]int64, 0, len(d.data))
 	for timestamp := range d.data {
 		timestamps = append(timestamps, timestamp)
@@ -90,35 +122,30 @@ func (d *setOfData) timeSeries() timeSeries {
 
 	slices.Sort(timestamps)
 
-	for _, timestamp := range timestamps {
-		bod := time.UnixMilli(timestamp)
-		data := d.data[timestamp]
-
-		if data.morningCount > 0 {
-			val := []any{
-				bod.Add(8 * time.Hour).UnixMilli(),
-				toFixed(data.morningSum / data.morningCount),
-			}
+	return timestamps
+}
 
-			series = append(series, val)
-		}
+func (d *setOfData) timeSeries() timeSeries {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
 
-		if data.dayCount > 0 {
-			val := []any{
-				bod.Add(14 * time.Hour).UnixMilli(),
-				toFixed(data.daySum / data.dayCount),
-			}
+	series := make(timeSeries, 0, len(d.data)*len(d.periods))
 
-			series = append(series, val)
-		}
+	for _, timestamp := range d.days() {
+		year, month, day := time.UnixMilli(timestamp).In(d.location).Date()
+		data := d.data[timestamp]
 
-		if data.eveningCount > 0 {
-			val := []any{
-				bod.Add(19 * time.Hour).UnixMilli(),
-				toFixed(data.eveningSum / data.eveningCount),
+		for i, period := range data {
+			if period.count == 0 {
+				continue
 			}
 
-			series = append(series, val)
+			plot := time.Date(year, month, day, 0, 0, 0, 0, d.location).Add(d.periods[i].Plot)
+
+			series = append(series, []any{
+				plot.UnixMilli(),
+				toFixed(period.sum / period.count),
+			})
 		}
 	}
 
@@ -5,16 +5,24 @@ import (
 	"testing"
 	"time"
 
+	"temperature-sensor/internal/config"
+
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
 func toBod(t time.Time) int64 {
-	return t.Truncate(24 * time.Hour).UnixMilli()
+	return beginningOfDay(t, time.UTC).UnixMilli()
 }
 
+const (
+	periodMorning = iota
+	periodDay
+	periodEvening
+)
+
 func TestPush(t *testing.T) {
-	set := newSetOfData()
+	set := newSetOfData(testConfig())
 
 	for i := range 20 {
 		day := i + 1
@@ -27,8 +35,8 @@ func TestPush(t *testing.T) {
 		set.push(10.5, morningTime)
 		set.push(15.5, morningTime)
 
-		assert.InEpsilon(t, float32(26), set.data[bod].morningSum, 1e-6)
-		assert.InEpsilon(t, float32(2), set.data[bod].morningCount, 1e-6)
+		assert.InEpsilon(t, float32(26), set.data[bod][periodMorning].sum, 1e-6)
+		assert.InEpsilon(t, float32(2), set.data[bod][periodMorning].count, 1e-6)
 
 		// Test day data
 		dayTime := time.Date(2023, 10, day, 14, 0, 0, 0, time.UTC)
@@ -36,8 +44,8 @@ func TestPush(t *testing.T) {
 		set.push(20.5, dayTime)
 		set.push(25.5, dayTime)
 
-		assert.InEpsilon(t, float32(46), set.data[bod].daySum, 1e-6)
-		assert.InEpsilon(t, float32(2), set.data[bod].dayCount, 1e-6)
+		assert.InEpsilon(t, float32(46), set.data[bod][periodDay].sum, 1e-6)
+		assert.InEpsilon(t, float32(2), set.data[bod][periodDay].count, 1e-6)
 
 		// Test evening data
 		eveningTime := time.Date(2023, 10, day, 20, 0, 0, 0, time.UTC)
@@ -45,13 +53,59 @@ func TestPush(t *testing.T) {
 		set.push(30.5, eveningTime)
 		set.push(35.5, eveningTime)
 
-		assert.InEpsilon(t, float32(66), set.data[bod].eveningSum, 1e-6)
-		assert.InEpsilon(t, float32(2), set.data[bod].eveningCount, 1e-6)
+		assert.InEpsilon(t, float32(66), set.data[bod][periodEvening].sum, 1e-6)
+		assert.InEpsilon(t, float32(2), set.data[bod][periodEvening].count, 1e-6)
 	}
 }
 
+func TestPushLocation(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.Location = moscow
+	set := newSetOfData(cfg)
+
+	// 07:30 in Moscow is still the previous day in UTC
+	morningTime := time.Date(2023, 10, 2, 7, 30, 0, 0, moscow)
+	// 23:30 in Moscow is 20:30 UTC of the same day
+	eveningTime := time.Date(2023, 10, 2, 23, 30, 0, 0, moscow)
+
+	set.push(10, morningTime)
+	set.push(20, eveningTime)
+
+	bod := time.Date(2023, 10, 2, 0, 0, 0, 0, moscow).UnixMilli()
+
+	require.Len(t, set.data, 1)
+	assert.InEpsilon(t, float32(10), set.data[bod][periodMorning].sum, 1e-6)
+	assert.InEpsilon(t, float32(20), set.data[bod][periodEvening].sum, 1e-6)
+
+	series := set.timeSeries()
+	require.Len(t, series, 2)
+	assert.Equal(t, time.Date(2023, 10, 2, 8, 0, 0, 0, moscow).UnixMilli(), series[0][0])
+	assert.Equal(t, time.Date(2023, 10, 2, 19, 0, 0, 0, moscow).UnixMilli(), series[1][0])
+}
+
+func TestPushCustomPeriods(t *testing.T) {
+	periods, err := config.ParsePeriods("night=00:00@03:00,day=09:00@12:00")
+	require.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.Periods = periods
+	set := newSetOfData(cfg)
+
+	set.push(1, time.Date(2023, 10, 2, 2, 0, 0, 0, time.UTC))
+	set.push(3, time.Date(2023, 10, 2, 8, 59, 0, 0, time.UTC))
+	set.push(5, time.Date(2023, 10, 2, 9, 0, 0, 0, time.UTC))
+
+	series := set.timeSeries()
+	require.Len(t, series, 2)
+	assert.Equal(t, []any{time.Date(2023, 10, 2, 3, 0, 0, 0, time.UTC).UnixMilli(), float32(2)}, series[0])
+	assert.Equal(t, []any{time.Date(2023, 10, 2, 12, 0, 0, 0, time.UTC).UnixMilli(), float32(5)}, series[1])
+}
+
 func TestTimeSeries(t *testing.T) {
-	set := newSetOfData()
+	set := newSetOfData(testConfig())
 
 	expectedSeries := make(timeSeries, 0, 60)
 
@@ -97,7 +151,7 @@ func TestTimeSeries(t *testing.T) {
 }
 
 func BenchmarkTimeSeries(b *testing.B) {
-	set := newSetOfData()
+	set := newSetOfData(testConfig())
 
 	// Add data
 	for i := range 20 {
@@ -123,7 +177,7 @@ func BenchmarkTimeSeries(b *testing.B) {
 }
 
 func TestRemove(t *testing.T) {
-	set := newSetOfData()
+	set := newSetOfData(testConfig())
 
 	for i := range 1000 {
 		timestamp := time.Date(2023, 10, i%20, i%24, 0, 0, 0, time.UTC)
@@ -136,7 +190,7 @@ func TestRemove(t *testing.T) {
 }
 
 func TestConcurrent(t *testing.T) {
-	set := newSetOfData()
+	set := newSetOfData(testConfig())
 
 	var wg sync.WaitGroup
 
@@ -0,0 +1,92 @@
+package dataset
+
+import "time"
+
+// Extreme is a minimum or maximum value and the moment it was measured.
+type Extreme struct {
+	Value     float32 `json:"value"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// Extremes are the lowest and highest values of a day or of one of its
+// periods. Period is empty for a whole day, Date is the beginning of the day.
+type Extremes struct {
+	Period string  `json:"period,omitempty"`
+	Date   int64   `json:"date"`
+	Min    Extreme `json:"min"`
+	Max    Extreme `json:"max"`
+}
+
+type MetricExtremes struct {
+	Daily   []Extremes `json:"daily"`
+	Periods []Extremes `json:"periods"`
+}
+
+func roundExtreme(e Extreme) Extreme {
+	return Extreme{Value: toFixed(e.Value), Timestamp: e.Timestamp}
+}
+
+// dayExtremes folds the periods of a day, the caller holds the lock.
+func (d *setOfData) dayExtremes(date int64) (Extremes, bool) {
+	day := Extremes{Date: date}
+	found := false
+
+	for _, period := range d.data[date] {
+		if period.count == 0 {
+			continue
+		}
+
+		if !found || period.min.Value < day.Min.Value {
+			day.Min = roundExtreme(period.min)
+		}
+
+		if !found || period.max.Value > day.Max.Value {
+			day.Max = roundExtreme(period.max)
+		}
+
+		found = true
+	}
+
+	return day, found
+}
+
+func (d *setOfData) extremes() *MetricExtremes {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	extremes := &MetricExtremes{
+		Daily:   make([]Extremes, 0, len(d.data)),
+		Periods: make([]Extremes, 0, len(d.data)*len(d.periods)),
+	}
+
+	for _, date := range d.days() {
+		if day, ok := d.dayExtremes(date); ok {
+			extremes.Daily = append(extremes.Daily, day)
+		}
+
+		for i, period := range d.data[date] {
+			if period.count == 0 {
+				continue
+			}
+
+			extremes.Periods = append(extremes.Periods, Extremes{
+				Period: d.periods[i].Name,
+				Date:   date,
+				Min:    roundExtreme(period.min),
+				Max:    roundExtreme(period.max),
+			})
+		}
+	}
+
+	return extremes
+}
+
+// today returns the extremes of the calendar day now belongs to.
+func (d *setOfData) today(now time.Time) (Extremes, bool) {
+	date := beginningOfDay(now, d.location).UnixMilli()
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dayExtremes(date)
+}
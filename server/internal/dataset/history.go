@@ -0,0 +1,290 @@
+package dataset
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"temperature-sensor/internal/config"
+)
+
+// Resolution selects the tier a series is built from.
+type Resolution string
+
+const (
+	// ResolutionAuto picks the finest tier that covers the requested range.
+	ResolutionAuto Resolution = ""
+	// ResolutionPeriod is the morning/day/evening averages of the dashboard chart.
+	ResolutionPeriod     Resolution = "period"
+	ResolutionRaw        Resolution = "raw"
+	ResolutionFiveMinute Resolution = "5m"
+	ResolutionHour       Resolution = "1h"
+	ResolutionDay        Resolution = "1d"
+)
+
+const (
+	rawMaxSpan        = 6 * time.Hour
+	fiveMinuteMaxSpan = 3 * 24 * time.Hour
+	hourMaxSpan       = 60 * 24 * time.Hour
+)
+
+// ParseResolution validates a resolution given by a client.
+func ParseResolution(s string) (Resolution, bool) {
+	switch r := Resolution(s); r {
+	case ResolutionAuto, ResolutionPeriod, ResolutionRaw, ResolutionFiveMinute, ResolutionHour, ResolutionDay:
+		return r, true
+	default:
+		return "", false
+	}
+}
+
+type point struct {
+	timestamp int64
+	value     float32
+}
+
+type bucket struct {
+	min,
+	max,
+	sum float32
+	count int
+}
+
+func (b *bucket) add(value float32) {
+	if b.count == 0 || value < b.min {
+		b.min = value
+	}
+
+	if b.count == 0 || value > b.max {
+		b.max = value
+	}
+
+	b.sum += value
+	b.count++
+}
+
+// tier rolls raw values up into fixed size buckets.
+type tier struct {
+	resolution Resolution
+	step       time.Duration
+	retention  time.Duration
+	location   *time.Location
+	buckets    map[int64]*bucket
+}
+
+func newTier(resolution Resolution, step, retention time.Duration, location *time.Location) *tier {
+	return &tier{
+		resolution: resolution,
+		step:       step,
+		retention:  retention,
+		location:   location,
+		buckets:    make(map[int64]*bucket),
+	}
+}
+
+// bucketStart aligns buckets to the wall clock of the configured location,
+// so hours of half-hour zones and days start where the user expects them.
+func (t *tier) bucketStart(timestamp time.Time) time.Time {
+	if t.step >= 24*time.Hour {
+		return beginningOfDay(timestamp, t.location)
+	}
+
+	_, offset := timestamp.In(t.location).Zone()
+	shift := time.Duration(offset) * time.Second
+
+	return timestamp.Add(shift).Truncate(t.step).Add(-shift)
+}
+
+func (t *tier) push(value float32, timestamp time.Time) {
+	key := t.bucketStart(timestamp).UnixMilli()
+
+	b, ok := t.buckets[key]
+	if !ok {
+		b = &bucket{}
+		t.buckets[key] = b
+	}
+
+	b.add(value)
+}
+
+func (t *tier) remove(now time.Time) {
+	before := now.Add(-t.retention).UnixMilli()
+
+	for key := range t.buckets {
+		if key < before {
+			delete(t.buckets, key)
+		}
+	}
+}
+
+// [[timestamp, avg, min, max, count], ...].
+func (t *tier) timeSeries(from, to int64) timeSeries {
+	keys := make([]int64, 0, len(t.buckets))
+
+	for key := range t.buckets {
+		if key >= from && key <= to {
+			keys = append(keys, key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	series := make(timeSeries, 0, len(keys))
+
+	for _, key := range keys {
+		b := t.buckets[key]
+		series = append(series, []any{
+			key,
+			toFixed(b.sum / float32(b.count)),
+			toFixed(b.min),
+			toFixed(b.max),
+			b.count,
+		})
+	}
+
+	return series
+}
+
+// history keeps raw values for a short window and downsampled tiers for longer.
+type history struct {
+	raw          []point
+	rawRetention time.Duration
+	tiers        []*tier
+	mu           sync.RWMutex
+}
+
+func newHistory(cfg config.Dataset) *history {
+	return &history{
+		rawRetention: cfg.RawRetention,
+		tiers: []*tier{
+			newTier(ResolutionFiveMinute, 5*time.Minute, cfg.FiveMinuteRetention, cfg.Location),
+			newTier(ResolutionHour, time.Hour, cfg.HourRetention, cfg.Location),
+			newTier(ResolutionDay, 24*time.Hour, cfg.DayRetention, cfg.Location),
+		},
+	}
+}
+
+// push adds a value to the tiers and, unless it is before rawFrom, to the
+// raw points. Imported points older than the raw retention would only wait
+// for the next cleanup there.
+func (h *history) push(value float32, timestamp, rawFrom time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, t := range h.tiers {
+		t.push(value, timestamp)
+	}
+
+	if !timestamp.Before(rawFrom) {
+		h.insertRaw(value, timestamp)
+	}
+}
+
+// pushRaw adds a value the tiers already include to the raw points.
+func (h *history) pushRaw(value float32, timestamp time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.insertRaw(value, timestamp)
+}
+
+// insertRaw keeps the raw points sorted, the caller holds the lock.
+func (h *history) insertRaw(value float32, timestamp time.Time) {
+	p := point{timestamp: timestamp.UnixMilli(), value: value}
+
+	// packets arrive in order, restored or imported ones may not
+	i := len(h.raw)
+	for i > 0 && h.raw[i-1].timestamp > p.timestamp {
+		i--
+	}
+
+	h.raw = slices.Insert(h.raw, i, p)
+}
+
+func (h *history) remove(now time.Time) {
+	before := now.Add(-h.rawRetention).UnixMilli()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(h.raw, before, func(p point, target int64) int {
+		return cmp.Compare(p.timestamp, target)
+	})
+	h.raw = slices.Delete(h.raw, 0, i)
+
+	for _, t := range h.tiers {
+		t.remove(now)
+	}
+}
+
+// index passes the timestamps of the raw points to raw and the beginnings of
+// the days the day tier holds to days.
+func (h *history) index(raw, days func(timestamp int64)) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, p := range h.raw {
+		raw(p.timestamp)
+	}
+
+	for _, t := range h.tiers {
+		if t.resolution != ResolutionDay {
+			continue
+		}
+
+		for key := range t.buckets {
+			days(key)
+		}
+	}
+}
+
+// [[timestamp, value], ...].
+func (h *history) rawSeries(from, to int64) timeSeries {
+	series := make(timeSeries, 0)
+
+	for _, p := range h.raw {
+		if p.timestamp >= from && p.timestamp <= to {
+			series = append(series, []any{p.timestamp, toFixed(p.value)})
+		}
+	}
+
+	return series
+}
+
+func (h *history) timeSeries(resolution Resolution, from, to time.Time) timeSeries {
+	fromMilli, toMilli := from.UnixMilli(), to.UnixMilli()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	if resolution == ResolutionRaw {
+		return h.rawSeries(fromMilli, toMilli)
+	}
+
+	for _, t := range h.tiers {
+		if t.resolution == resolution {
+			return t.timeSeries(fromMilli, toMilli)
+		}
+	}
+
+	return timeSeries{}
+}
+
+// pickResolution returns the finest tier that still holds data as old as
+// from and does not produce too many points for the span.
+func pickResolution(cfg config.Dataset, now, from, to time.Time) Resolution {
+	span := to.Sub(from)
+	age := now.Sub(from)
+
+	switch {
+	case span <= rawMaxSpan && age <= cfg.RawRetention:
+		return ResolutionRaw
+	case span <= fiveMinuteMaxSpan && age <= cfg.FiveMinuteRetention:
+		return ResolutionFiveMinute
+	case span <= hourMaxSpan && age <= cfg.HourRetention:
+		return ResolutionHour
+	default:
+		return ResolutionDay
+	}
+}
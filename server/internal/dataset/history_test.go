@@ -0,0 +1,124 @@
+package dataset //nolint:testpackage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryTiers(t *testing.T) {
+	h := newHistory(testConfig())
+	start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// one reading per minute for two hours
+	for i := range 120 {
+		h.push(float32(i), start.Add(time.Duration(i)*time.Minute), time.Time{})
+	}
+
+	end := start.Add(2 * time.Hour)
+
+	raw := h.timeSeries(ResolutionRaw, start, end)
+	require.Len(t, raw, 120)
+	assert.Equal(t, []any{start.UnixMilli(), float32(0)}, raw[0])
+
+	fiveMinutes := h.timeSeries(ResolutionFiveMinute, start, end)
+	require.Len(t, fiveMinutes, 24)
+	assert.Equal(t, []any{start.UnixMilli(), float32(2), float32(0), float32(4), 5}, fiveMinutes[0])
+
+	hours := h.timeSeries(ResolutionHour, start, end)
+	require.Len(t, hours, 2)
+	assert.Equal(t, []any{start.Add(time.Hour).UnixMilli(), float32(89.5), float32(60), float32(119), 60}, hours[1])
+
+	days := h.timeSeries(ResolutionDay, start, end)
+	require.Len(t, days, 1)
+	assert.Equal(t, 120, days[0][4])
+
+	// range is applied
+	assert.Len(t, h.timeSeries(ResolutionRaw, start.Add(time.Hour), end), 60)
+}
+
+func TestHistoryOutOfOrder(t *testing.T) {
+	h := newHistory(testConfig())
+	start := time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	h.push(3, start.Add(3*time.Minute), time.Time{})
+	h.push(1, start.Add(1*time.Minute), time.Time{})
+	h.push(2, start.Add(2*time.Minute), time.Time{})
+
+	raw := h.timeSeries(ResolutionRaw, start, start.Add(time.Hour))
+	require.Len(t, raw, 3)
+
+	for i, p := range raw {
+		assert.Equal(t, float32(i+1), p[1])
+	}
+}
+
+func TestHistoryRemove(t *testing.T) {
+	cfg := testConfig()
+	h := newHistory(cfg)
+	start := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// one reading per hour for 400 days
+	for i := range 400 * 24 {
+		h.push(1, start.Add(time.Duration(i)*time.Hour), time.Time{})
+	}
+
+	now := start.Add(400 * 24 * time.Hour)
+	h.remove(now)
+
+	assert.Len(t, h.raw, 48)
+	assert.Len(t, h.tiers[0].buckets, 7*24)
+	assert.Len(t, h.tiers[1].buckets, 90*24)
+	assert.Len(t, h.tiers[2].buckets, 365)
+}
+
+func TestPickResolution(t *testing.T) {
+	cfg := testConfig()
+	now := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		from     time.Time
+		to       time.Time
+		expected Resolution
+	}{
+		{now.Add(-time.Hour), now, ResolutionRaw},
+		{now.Add(-24 * time.Hour), now, ResolutionFiveMinute},
+		// short span beyond the raw window
+		{now.Add(-72 * time.Hour), now.Add(-70 * time.Hour), ResolutionFiveMinute},
+		{now.AddDate(0, 0, -30), now, ResolutionHour},
+		{now.AddDate(0, 0, -100), now.AddDate(0, 0, -99), ResolutionDay},
+		{now.AddDate(-1, 0, 0), now, ResolutionDay},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, pickResolution(cfg, now, test.from, test.to), "from: %s to: %s", test.from, test.to)
+	}
+}
+
+func TestHistoryLocation(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	require.NoError(t, err)
+
+	cfg := testConfig()
+	cfg.Location = kolkata
+	h := newHistory(cfg)
+
+	// 10:45 local is 05:15 UTC, the local hour starts at 10:00
+	h.push(1, time.Date(2023, 10, 2, 10, 45, 0, 0, kolkata), time.Time{})
+	// 01:00 local is still the previous day in UTC
+	h.push(3, time.Date(2023, 10, 2, 1, 0, 0, 0, kolkata), time.Time{})
+
+	from := time.Date(2023, 10, 1, 0, 0, 0, 0, kolkata)
+	to := time.Date(2023, 10, 3, 0, 0, 0, 0, kolkata)
+
+	hours := h.timeSeries(ResolutionHour, from, to)
+	require.Len(t, hours, 2)
+	assert.Equal(t, time.Date(2023, 10, 2, 10, 0, 0, 0, kolkata).UnixMilli(), hours[1][0])
+
+	days := h.timeSeries(ResolutionDay, from, to)
+	require.Len(t, days, 1)
+	assert.Equal(t, time.Date(2023, 10, 2, 0, 0, 0, 0, kolkata).UnixMilli(), days[0][0])
+	assert.Equal(t, float32(2), days[0][1])
+}
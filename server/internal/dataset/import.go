@@ -0,0 +1,114 @@
+package dataset
+
+import (
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+// ImportResult counts what happened to imported packets.
+type ImportResult struct {
+	Imported int `json:"imported"`
+	// Duplicates have a reading of the same device at the same time, or,
+	// older than the raw retention, fall on a day the device has readings of.
+	Duplicates int `json:"duplicates"`
+	// Expired are older than anything Stats keeps.
+	Expired int `json:"expired"`
+}
+
+type readingKey struct {
+	device    string
+	timestamp int64
+}
+
+func newReadingKey(data packet.Packet) readingKey {
+	device := data.Device
+	if device == "" {
+		device = defaultDevice
+	}
+
+	return readingKey{device: device, timestamp: data.Timestamp.UnixMilli()}
+}
+
+// importIndex tells readings Stats has from new ones. The raw points know
+// every reading, older ones were folded into tiers and are only known by
+// their day.
+type importIndex struct {
+	readings map[readingKey]struct{}
+	days     map[readingKey]struct{}
+}
+
+func (s *Stats) importIndex() *importIndex {
+	idx := &importIndex{
+		readings: make(map[readingKey]struct{}),
+		days:     make(map[readingKey]struct{}),
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for id, dev := range s.devices {
+		for _, m := range dev.metrics {
+			m.history.index(
+				func(timestamp int64) { idx.readings[readingKey{device: id, timestamp: timestamp}] = struct{}{} },
+				func(date int64) { idx.days[readingKey{device: id, timestamp: date}] = struct{}{} },
+			)
+		}
+	}
+
+	return idx
+}
+
+// Import pushes the packets read by read through the same path as live ones.
+// Packets Stats already has are skipped, so importing a file twice changes
+// nothing.
+func (s *Stats) Import(now time.Time, read func(fn func(data packet.Packet) error) error) (ImportResult, error) {
+	idx := s.importIndex()
+	oldest := now.Add(-s.storageRetention())
+	rawFrom := now.Add(-s.cfg.RawRetention)
+
+	var result ImportResult
+
+	err := read(func(data packet.Packet) error {
+		key := newReadingKey(data)
+
+		if _, ok := idx.readings[key]; ok {
+			result.Duplicates++
+
+			return nil
+		}
+
+		if data.Timestamp.Before(oldest) {
+			result.Expired++
+
+			return nil
+		}
+
+		// days are looked up as they were before the import
+		day := readingKey{device: key.device, timestamp: beginningOfDay(data.Timestamp, s.cfg.Location).UnixMilli()}
+		if _, ok := idx.days[day]; ok && data.Timestamp.Before(rawFrom) {
+			result.Duplicates++
+
+			return nil
+		}
+
+		idx.readings[key] = struct{}{}
+
+		if err := s.push(data, rawFrom); err != nil {
+			return err
+		}
+
+		result.Imported++
+
+		return nil
+	})
+
+	// imported packets are older than the aggregates say they include
+	if result.Imported > 0 {
+		if checkpointErr := s.checkpoint(); err == nil {
+			err = checkpointErr
+		}
+	}
+
+	return result, err
+}
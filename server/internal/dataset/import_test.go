@@ -0,0 +1,87 @@
+package dataset //nolint:testpackage
+
+import (
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readPackets(packets []packet.Packet) func(fn func(data packet.Packet) error) error {
+	return func(fn func(data packet.Packet) error) error {
+		for _, p := range packets {
+			if err := fn(p); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+func TestStatsImport(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	defer storage.Close()
+
+	now := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+	stats := NewStats(testConfig(), storage)
+
+	require.NoError(t, stats.Push(packet.Packet{Device: "balcony", Timestamp: now, Temperature: 10}))
+
+	packets := []packet.Packet{
+		{Device: "balcony", Timestamp: now.Add(-2 * time.Hour), Temperature: 20},
+		{Device: "balcony", Timestamp: now.Add(-time.Hour), Temperature: 21},
+		{Timestamp: now.Add(-time.Hour), Temperature: 22},
+		{Device: "balcony", Timestamp: now.AddDate(0, 0, -10), Temperature: 19},
+		{Device: "balcony", Timestamp: now.AddDate(-2, 0, 0), Temperature: 23},
+	}
+
+	result, err := stats.Import(now, readPackets(packets))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 4, Expired: 1}, result)
+
+	// importing again changes nothing
+	result, err = stats.Import(now, readPackets(packets))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Duplicates: 4, Expired: 1}, result)
+	assert.Len(t, loadAll(t, storage), 5)
+
+	// older readings do not replace the current one
+	current, ok := stats.Current("balcony")
+	require.True(t, ok)
+	assert.InEpsilon(t, float32(10), current.Temperature, 1e-6)
+
+	assert.Equal(t, []string{"balcony", defaultDevice}, stats.Devices())
+
+	// only the tiers keep readings older than the raw retention
+	raw := stats.Series(Query{Device: "balcony", Resolution: ResolutionRaw, From: now.AddDate(-3, 0, 0), To: now})
+	assert.Len(t, raw.Metrics[MetricTemperature], 3)
+}
+
+func TestStatsImportWithoutStorage(t *testing.T) {
+	now := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+	stats := NewStats(testConfig(), NewMemoryStorage())
+
+	packets := []packet.Packet{
+		{Device: "balcony", Timestamp: now.Add(-time.Hour), Temperature: 21},
+		{Device: "balcony", Timestamp: now.AddDate(0, 0, -10), Temperature: 19},
+	}
+
+	result, err := stats.Import(now, readPackets(packets))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 2}, result)
+
+	// the series tell what was imported, days older than the raw retention
+	// that have readings are skipped as a whole
+	result, err = stats.Import(now, readPackets(append(packets,
+		packet.Packet{Device: "balcony", Timestamp: now.AddDate(0, 0, -10).Add(time.Hour), Temperature: 18},
+		packet.Packet{Device: "balcony", Timestamp: now.AddDate(0, 0, -9), Temperature: 17},
+	)))
+	require.NoError(t, err)
+	assert.Equal(t, ImportResult{Imported: 1, Duplicates: 3}, result)
+}
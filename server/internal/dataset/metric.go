@@ -0,0 +1,156 @@
+package dataset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+)
+
+const (
+	MetricTemperature = "temperature"
+	MetricHumidity    = "humidity"
+	MetricPressure    = "pressure"
+	MetricVoltage     = "voltage"
+
+	// seriesResolutionKey and seriesExtremesKey share the JSON object with
+	// the metric series.
+	seriesResolutionKey = "resolution"
+	seriesExtremesKey   = "extremes"
+)
+
+var (
+	errMetricExists   = errors.New("metric already registered")
+	errMetricReserved = errors.New("metric name is reserved")
+	errMetricsFrozen  = errors.New("metrics must be registered before the first packet")
+)
+
+// Metric extracts one value from a packet to keep a series for.
+type Metric struct {
+	Name  string
+	Value func(data packet.Packet) float32
+}
+
+func defaultMetrics() []Metric {
+	return []Metric{
+		{Name: MetricTemperature, Value: func(data packet.Packet) float32 { return data.Temperature }},
+		{Name: MetricHumidity, Value: func(data packet.Packet) float32 { return data.Humidity }},
+		{Name: MetricPressure, Value: func(data packet.Packet) float32 { return data.Pressure }},
+		{Name: MetricVoltage, Value: func(data packet.Packet) float32 { return data.Voltage }},
+	}
+}
+
+// metricSeries is everything Stats keeps for one metric of one device.
+type metricSeries struct {
+	metric  Metric
+	periods *setOfData
+	history *history
+}
+
+func newMetricSeries(cfg config.Dataset, metric Metric) *metricSeries {
+	return &metricSeries{
+		metric:  metric,
+		periods: newSetOfData(cfg),
+		history: newHistory(cfg),
+	}
+}
+
+func (m *metricSeries) push(data packet.Packet, rawFrom time.Time) {
+	// metric names match the packet fields, a missing value is not a zero
+	if !data.Has(m.metric.Name) {
+		return
+	}
+
+	value := m.metric.Value(data)
+
+	m.periods.push(value, data.Timestamp)
+	m.history.push(value, data.Timestamp, rawFrom)
+}
+
+// pushRaw restores a packet the aggregates already include.
+func (m *metricSeries) pushRaw(data packet.Packet) {
+	if data.Has(m.metric.Name) {
+		m.history.pushRaw(m.metric.Value(data), data.Timestamp)
+	}
+}
+
+func (m *metricSeries) remove(now time.Time) {
+	m.periods.remove(now.AddDate(0, 0, -retentionDays))
+	m.history.remove(now)
+}
+
+func (m *metricSeries) extremes() *MetricExtremes {
+	return m.periods.extremes()
+}
+
+func (m *metricSeries) today(now time.Time) (Extremes, bool) {
+	return m.periods.today(now)
+}
+
+func (m *metricSeries) timeSeries(resolution Resolution, from, to time.Time) timeSeries {
+	if resolution == ResolutionPeriod {
+		return m.periods.timeSeries()
+	}
+
+	return m.history.timeSeries(resolution, from, to)
+}
+
+// Series holds one time series per metric, encoded next to the resolution
+// and, for the period resolution, the extremes of every metric:
+// {"resolution": "period", "temperature": [...], "extremes": {"temperature": {...}}}.
+type Series struct {
+	Resolution Resolution
+	Metrics    map[string]timeSeries
+	Extremes   map[string]*MetricExtremes
+}
+
+func (s *Series) MarshalJSON() ([]byte, error) {
+	object := make(map[string]any, len(s.Metrics)+2)
+
+	for name, series := range s.Metrics {
+		object[name] = series
+	}
+
+	object[seriesResolutionKey] = s.Resolution
+
+	if s.Extremes != nil {
+		object[seriesExtremesKey] = s.Extremes
+	}
+
+	return json.Marshal(object)
+}
+
+// Only returns the series restricted to a single metric.
+func (s *Series) Only(metric string) *Series {
+	only := &Series{
+		Resolution: s.Resolution,
+		Metrics:    make(map[string]timeSeries, 1),
+	}
+
+	if series, ok := s.Metrics[metric]; ok {
+		only.Metrics[metric] = series
+	}
+
+	if extremes, ok := s.Extremes[metric]; ok {
+		only.Extremes = map[string]*MetricExtremes{metric: extremes}
+	}
+
+	return only
+}
+
+func validateMetric(metrics []Metric, metric Metric) error {
+	if metric.Name == seriesResolutionKey || metric.Name == seriesExtremesKey {
+		return fmt.Errorf("%w: %s", errMetricReserved, metric.Name)
+	}
+
+	for _, m := range metrics {
+		if m.Name == metric.Name {
+			return fmt.Errorf("%w: %s", errMetricExists, metric.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,190 @@
+package dataset
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+// snapshot is what Stats saves besides the packet log, so the log only has
+// to reach back as far as the raw points.
+type snapshot struct {
+	Devices map[string]*deviceSnapshot `json:"devices"`
+}
+
+type deviceSnapshot struct {
+	Current packet.Packet `json:"current"`
+	// Through is the newest packet the aggregates include, logged packets up
+	// to it only fill the raw points on restore.
+	Through time.Time                  `json:"through"`
+	Metrics map[string]*metricSnapshot `json:"metrics"`
+}
+
+type metricSnapshot struct {
+	Tiers   map[Resolution]map[int64]bucketSnapshot `json:"tiers"`
+	Periods map[int64][]periodSnapshot              `json:"periods"`
+}
+
+type bucketSnapshot struct {
+	Min   float32 `json:"min"`
+	Max   float32 `json:"max"`
+	Sum   float32 `json:"sum"`
+	Count int     `json:"count"`
+}
+
+type periodSnapshot struct {
+	Sum   float32 `json:"sum"`
+	Count float32 `json:"count"`
+	Min   Extreme `json:"min"`
+	Max   Extreme `json:"max"`
+}
+
+// checkpoint saves the aggregates of every device.
+func (s *Stats) checkpoint() error {
+	s.mu.RLock()
+
+	snap := &snapshot{Devices: make(map[string]*deviceSnapshot, len(s.devices))}
+	for id, dev := range s.devices {
+		snap.Devices[id] = dev.snapshot()
+	}
+
+	s.mu.RUnlock()
+
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return fmt.Errorf("encode aggregates: %w", err)
+	}
+
+	if err := s.storage.SaveAggregates(data); err != nil {
+		return fmt.Errorf("save aggregates: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Stats) restoreAggregates() error {
+	data, err := s.storage.LoadAggregates()
+	if err != nil {
+		return fmt.Errorf("load aggregates: %w", err)
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decode aggregates: %w", err)
+	}
+
+	for id, ds := range snap.Devices {
+		s.device(id).restore(ds)
+	}
+
+	return nil
+}
+
+func (d *device) snapshot() *deviceSnapshot {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	ds := &deviceSnapshot{
+		Current: d.packet.Get(),
+		Through: d.through,
+		Metrics: make(map[string]*metricSnapshot, len(d.metrics)),
+	}
+
+	for _, m := range d.metrics {
+		ds.Metrics[m.metric.Name] = &metricSnapshot{
+			Tiers:   m.history.snapshot(),
+			Periods: m.periods.snapshot(),
+		}
+	}
+
+	return ds
+}
+
+// restore sets the aggregates of a device no packet was pushed to yet,
+// metrics registered since have none.
+func (d *device) restore(ds *deviceSnapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.packet.Set(ds.Current)
+	d.through = ds.Through
+
+	for _, m := range d.metrics {
+		if ms, ok := ds.Metrics[m.metric.Name]; ok {
+			m.history.restore(ms.Tiers)
+			m.periods.restore(ms.Periods)
+		}
+	}
+}
+
+func (h *history) snapshot() map[Resolution]map[int64]bucketSnapshot {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	tiers := make(map[Resolution]map[int64]bucketSnapshot, len(h.tiers))
+
+	for _, t := range h.tiers {
+		buckets := make(map[int64]bucketSnapshot, len(t.buckets))
+		for key, b := range t.buckets {
+			buckets[key] = bucketSnapshot{Min: b.min, Max: b.max, Sum: b.sum, Count: b.count}
+		}
+
+		tiers[t.resolution] = buckets
+	}
+
+	return tiers
+}
+
+func (h *history) restore(tiers map[Resolution]map[int64]bucketSnapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, t := range h.tiers {
+		for key, b := range tiers[t.resolution] {
+			t.buckets[key] = &bucket{min: b.Min, max: b.Max, sum: b.Sum, count: b.Count}
+		}
+	}
+}
+
+func (d *setOfData) snapshot() map[int64][]periodSnapshot {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	days := make(map[int64][]periodSnapshot, len(d.data))
+
+	for date, data := range d.data {
+		periods := make([]periodSnapshot, len(data))
+		for i, p := range data {
+			periods[i] = periodSnapshot{Sum: p.sum, Count: p.count, Min: p.min, Max: p.max}
+		}
+
+		days[date] = periods
+	}
+
+	return days
+}
+
+func (d *setOfData) restore(days map[int64][]periodSnapshot) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for date, periods := range days {
+		// saved with other -day-periods
+		if len(periods) != len(d.periods) {
+			continue
+		}
+
+		data := make(aggregatedData, len(periods))
+		for i, p := range periods {
+			data[i] = periodData{sum: p.Sum, count: p.Count, min: p.Min, max: p.Max}
+		}
+
+		d.data[date] = data
+	}
+}
@@ -2,12 +2,22 @@ package dataset
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
+	"slices"
+	"sync"
 	"time"
 
+	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/packet"
 )
 
+const (
+	// defaultDevice collects packets from sources that do not identify the sensor.
+	defaultDevice = "default"
+	retentionDays = 7
+)
+
 type safePacket interface {
 	Set(data packet.Packet)
 	Get() packet.Packet
@@ -18,33 +28,268 @@ type eventEmitter interface {
 	Unsubscribe(ch chan packet.Packet)
 }
 
+type device struct {
+	metrics []*metricSeries
+	packet  safePacket
+	// through is the newest packet the aggregates include.
+	through time.Time
+	mu      sync.Mutex
+}
+
+func newDevice(cfg config.Dataset, metrics []Metric) *device {
+	dev := &device{
+		metrics: make([]*metricSeries, 0, len(metrics)),
+		packet:  packet.NewSafePacket(),
+	}
+
+	for _, metric := range metrics {
+		dev.metrics = append(dev.metrics, newMetricSeries(cfg, metric))
+	}
+
+	return dev
+}
+
+// push adds a packet to every metric, see history.push for rawFrom.
+func (d *device) push(data packet.Packet, rawFrom time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.fold(data, rawFrom)
+}
+
+// replay restores a logged packet, one the restored aggregates already
+// include only fills the raw points.
+func (d *device) replay(data packet.Packet) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if data.Timestamp.After(d.through) {
+		d.fold(data, time.Time{})
+
+		return
+	}
+
+	d.setCurrent(data)
+
+	for _, m := range d.metrics {
+		m.pushRaw(data)
+	}
+}
+
+// fold adds a packet to the aggregates, the caller holds the lock.
+func (d *device) fold(data packet.Packet, rawFrom time.Time) {
+	d.setCurrent(data)
+
+	if data.Timestamp.After(d.through) {
+		d.through = data.Timestamp
+	}
+
+	for _, m := range d.metrics {
+		m.push(data, rawFrom)
+	}
+}
+
+func (d *device) setCurrent(data packet.Packet) {
+	// imported history must not replace a newer current reading
+	if !data.Timestamp.Before(d.packet.Get().Timestamp) {
+		d.packet.Set(data)
+	}
+}
+
+func (d *device) remove(now time.Time) {
+	for _, m := range d.metrics {
+		m.remove(now)
+	}
+}
+
+func (d *device) series(resolution Resolution, from, to time.Time) *Series {
+	series := &Series{
+		Resolution: resolution,
+		Metrics:    make(map[string]timeSeries, len(d.metrics)),
+	}
+
+	for _, m := range d.metrics {
+		series.Metrics[m.metric.Name] = m.timeSeries(resolution, from, to)
+	}
+
+	if resolution == ResolutionPeriod {
+		series.Extremes = make(map[string]*MetricExtremes, len(d.metrics))
+
+		for _, m := range d.metrics {
+			series.Extremes[m.metric.Name] = m.extremes()
+		}
+	}
+
+	return series
+}
+
+// today returns the high and low of every metric measured today.
+func (d *device) today(now time.Time) map[string]Extremes {
+	today := make(map[string]Extremes, len(d.metrics))
+
+	for _, m := range d.metrics {
+		if extremes, ok := m.today(now); ok {
+			today[m.metric.Name] = extremes
+		}
+	}
+
+	return today
+}
+
 type Stats struct {
-	temperature *setOfData
-	pressure    *setOfData
-	voltage     *setOfData
-	packet      safePacket
+	cfg     config.Dataset
+	metrics []Metric
+	devices map[string]*device
+	storage Storage
+	mu      sync.RWMutex
+}
+
+type DeviceResponse struct {
+	Chart   *Series             `json:"chart"`
+	Current packet.Packet       `json:"current"`
+	Today   map[string]Extremes `json:"today"`
 }
 
 type EventResponse struct {
-	Chart   *Series       `json:"chart"`
-	Current packet.Packet `json:"current"`
+	Devices map[string]*DeviceResponse `json:"devices"`
 }
 
-type Series struct {
-	Temperature timeSeries `json:"temperature"`
-	Pressure    timeSeries `json:"pressure"`
-	Voltage     timeSeries `json:"voltage"`
+// Query selects a device series. Zero From and To leave the range open.
+type Query struct {
+	Device     string
+	From       time.Time
+	To         time.Time
+	Resolution Resolution
 }
 
-func NewStats() *Stats {
+func NewStats(cfg config.Dataset, storage Storage) *Stats {
 	return &Stats{
-		temperature: newSetOfData(),
-		pressure:    newSetOfData(),
-		voltage:     newSetOfData(),
-		packet:      packet.NewSafePacket(),
+		cfg:     cfg,
+		metrics: defaultMetrics(),
+		devices: make(map[string]*device),
+		storage: storage,
 	}
 }
 
+// Register adds a metric on top of the default ones. It has to be called
+// before Restore and Subscribe.
+func (s *Stats) Register(metric Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.devices) > 0 {
+		return errMetricsFrozen
+	}
+
+	if err := validateMetric(s.metrics, metric); err != nil {
+		return err
+	}
+
+	s.metrics = append(s.metrics, metric)
+
+	return nil
+}
+
+// Restore fills Stats with the aggregates and the packets kept in storage.
+func (s *Stats) Restore(now time.Time) error {
+	if err := s.restoreAggregates(); err != nil {
+		return err
+	}
+
+	count := 0
+
+	err := s.storage.Load(func(data packet.Packet) {
+		s.device(data.Device).replay(data)
+		count++
+	})
+	if err != nil {
+		return fmt.Errorf("load storage: %w", err)
+	}
+
+	slog.Info("restored packets from storage", "count", count)
+
+	return s.remove(now)
+}
+
+// storageRetention is how far back the longest kept tier reaches.
+func (s *Stats) storageRetention() time.Duration {
+	return max(
+		retentionDays*24*time.Hour,
+		s.cfg.RawRetention,
+		s.cfg.FiveMinuteRetention,
+		s.cfg.HourRetention,
+		s.cfg.DayRetention,
+	)
+}
+
+func (s *Stats) remove(now time.Time) error {
+	s.mu.RLock()
+	for _, dev := range s.devices {
+		dev.remove(now)
+	}
+	s.mu.RUnlock()
+
+	// the log has to keep what the saved aggregates do not include
+	if err := s.checkpoint(); err != nil {
+		return err
+	}
+
+	if err := s.storage.Remove(now.Add(-s.cfg.RawRetention)); err != nil {
+		return fmt.Errorf("remove from storage: %w", err)
+	}
+
+	return nil
+}
+
+func (s *Stats) device(id string) *device {
+	if id == "" {
+		id = defaultDevice
+	}
+
+	s.mu.RLock()
+	dev, ok := s.devices[id]
+	s.mu.RUnlock()
+
+	if ok {
+		return dev
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if dev, ok = s.devices[id]; !ok {
+		dev = newDevice(s.cfg, s.metrics)
+		s.devices[id] = dev
+	}
+
+	return dev
+}
+
+func (s *Stats) lookup(id string) (*device, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	dev, ok := s.devices[id]
+
+	return dev, ok
+}
+
+// Readings calls fn for every stored packet in the order they were received.
+func (s *Stats) Readings(fn func(data packet.Packet)) error {
+	return s.storage.Load(fn)
+}
+
+// Push aggregates the packet and appends it to storage.
+func (s *Stats) Push(data packet.Packet) error {
+	return s.push(data, time.Time{})
+}
+
+func (s *Stats) push(data packet.Packet, rawFrom time.Time) error {
+	s.device(data.Device).push(data, rawFrom)
+
+	return s.storage.Append(data)
+}
+
 func (s *Stats) Subscribe(ctx context.Context, emitter eventEmitter) error {
 	ch := emitter.Subscribe()
 	defer emitter.Unsubscribe(ch)
@@ -52,22 +297,71 @@ func (s *Stats) Subscribe(ctx context.Context, emitter eventEmitter) error {
 	for {
 		select {
 		case data := <-ch:
-			s.packet.Set(data)
-			s.temperature.push(data.Temperature, data.Timestamp)
-			s.pressure.push(data.Pressure, data.Timestamp)
-			s.voltage.push(data.Voltage, data.Timestamp)
+			if err := s.Push(data); err != nil {
+				slog.ErrorContext(ctx, "failed to store packet", "error", err)
+			}
 		case <-ctx.Done():
 			return nil
 		}
 	}
 }
 
-func (s *Stats) Series() *Series {
-	return &Series{
-		Temperature: s.temperature.timeSeries(),
-		Pressure:    s.pressure.timeSeries(),
-		Voltage:     s.voltage.timeSeries(),
+// Metrics returns the names of the registered metrics.
+func (s *Stats) Metrics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.metrics))
+	for _, metric := range s.metrics {
+		names = append(names, metric.Name)
+	}
+
+	return names
+}
+
+// Devices returns the sorted ids of all devices seen so far.
+func (s *Stats) Devices() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ids := make([]string, 0, len(s.devices))
+	for id := range s.devices {
+		ids = append(ids, id)
 	}
+
+	slices.Sort(ids)
+
+	return ids
+}
+
+// Series returns the device series at the requested resolution, an unknown
+// device has an empty series.
+func (s *Stats) Series(q Query) *Series {
+	now := time.Now()
+
+	from := q.From
+	if from.IsZero() {
+		from = now.Add(-s.storageRetention())
+	}
+
+	to := q.To
+	if to.IsZero() {
+		to = now
+	}
+
+	resolution := q.Resolution
+	if resolution == ResolutionAuto {
+		resolution = pickResolution(s.cfg, now, from, to)
+	}
+
+	dev, ok := s.lookup(q.Device)
+	if !ok {
+		s.mu.RLock()
+		dev = newDevice(s.cfg, s.metrics)
+		s.mu.RUnlock()
+	}
+
+	return dev.series(resolution, from, to)
 }
 
 func (s *Stats) Clear(ctx context.Context, interval time.Duration) error {
@@ -81,21 +375,40 @@ func (s *Stats) Clear(ctx context.Context, interval time.Duration) error {
 		case now := <-ticker.C:
 			slog.DebugContext(ctx, "running scheduled task clear")
 
-			sevenDaysAgo := now.AddDate(0, 0, -7)
-			s.temperature.remove(sevenDaysAgo)
-			s.pressure.remove(sevenDaysAgo)
-			s.voltage.remove(sevenDaysAgo)
+			if err := s.remove(now); err != nil {
+				slog.ErrorContext(ctx, "failed to clear", "error", err)
+			}
 		}
 	}
 }
 
-func (s *Stats) Current() packet.Packet {
-	return s.packet.Get()
+// Current returns the latest packet of the device.
+func (s *Stats) Current(id string) (packet.Packet, bool) {
+	dev, ok := s.lookup(id)
+	if !ok {
+		return packet.Packet{}, false
+	}
+
+	return dev.packet.Get(), true
 }
 
 func (s *Stats) EventResponse() *EventResponse {
-	return &EventResponse{
-		Current: s.Current(),
-		Chart:   s.Series(),
+	now := time.Now()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	response := &EventResponse{
+		Devices: make(map[string]*DeviceResponse, len(s.devices)),
 	}
+
+	for id, dev := range s.devices {
+		response.Devices[id] = &DeviceResponse{
+			Current: dev.packet.Get(),
+			Chart:   dev.series(ResolutionPeriod, time.Time{}, time.Time{}),
+			Today:   dev.today(now),
+		}
+	}
+
+	return response
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 	"time"
 
+	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/packet"
 
 	"github.com/stretchr/testify/assert"
@@ -24,41 +25,202 @@ func (m *mockSafePacket) Get() packet.Packet {
 	return m.data
 }
 
+func testConfig() config.Dataset {
+	periods, _ := config.ParsePeriods("morning=06:00@08:00,day=14:00@14:00,evening=19:00@19:00")
+
+	return config.Dataset{
+		Location:            time.UTC,
+		Periods:             periods,
+		RawRetention:        48 * time.Hour,
+		FiveMinuteRetention: 7 * 24 * time.Hour,
+		HourRetention:       90 * 24 * time.Hour,
+		DayRetention:        365 * 24 * time.Hour,
+	}
+}
+
 func TestEventResponse(t *testing.T) {
-	stats := &Stats{
-		temperature: newSetOfData(),
-		pressure:    newSetOfData(),
-		voltage:     newSetOfData(),
-		packet:      &mockSafePacket{},
+	stats := NewStats(testConfig(), NewMemoryStorage())
+	devices := []string{"balcony", "bedroom"}
+
+	for _, id := range devices {
+		dev := newDevice(testConfig(), defaultMetrics())
+		dev.packet = &mockSafePacket{}
+		stats.devices[id] = dev
 	}
 
-	var mockPacket packet.Packet
+	last := make(map[string]packet.Packet, len(devices))
 
 	for day := range 30 {
 		for hour := range 24 {
-			mockPacket.Temperature = rand.Float32() * 100 //nolint:gosec
-			mockPacket.Pressure = rand.Float32() * 2000   //nolint:gosec
-			mockPacket.Humidity = rand.Float32() * 100    //nolint:gosec
-			mockPacket.Voltage = rand.Float32() * 100     //nolint:gosec
+			for _, id := range devices {
+				var mockPacket packet.Packet
+
+				mockPacket.Device = id
+				mockPacket.Temperature = rand.Float32() * 100 //nolint:gosec
+				mockPacket.Pressure = rand.Float32() * 2000   //nolint:gosec
+				mockPacket.Humidity = rand.Float32() * 100    //nolint:gosec
+				mockPacket.Voltage = rand.Float32() * 100     //nolint:gosec
 
-			mockPacket.Timestamp = time.Date(2023, 10, day, hour, 0, 0, 0, time.UTC)
+				mockPacket.Timestamp = time.Date(2023, 10, day, hour, 0, 0, 0, time.UTC)
 
-			stats.packet.Set(mockPacket)
-			stats.temperature.push(mockPacket.Temperature, mockPacket.Timestamp)
-			stats.pressure.push(mockPacket.Pressure, mockPacket.Timestamp)
-			stats.voltage.push(mockPacket.Voltage, mockPacket.Timestamp)
+				stats.device(id).push(mockPacket, time.Time{})
+				last[id] = mockPacket
+			}
 		}
 	}
 
 	response := stats.EventResponse()
 
-	assert.Equal(t, mockPacket, response.Current)
+	require.Len(t, response.Devices, len(devices))
+
+	for _, id := range devices {
+		dev := response.Devices[id]
+		require.NotNil(t, dev, id)
 
-	assert.Len(t, response.Chart.Temperature, 90)
-	assert.Len(t, response.Chart.Pressure, 90)
-	assert.Len(t, response.Chart.Voltage, 90)
+		assert.Equal(t, last[id], dev.Current)
+
+		assert.Len(t, dev.Chart.Metrics[MetricTemperature], 90)
+		assert.Len(t, dev.Chart.Metrics[MetricHumidity], 90)
+		assert.Len(t, dev.Chart.Metrics[MetricPressure], 90)
+		assert.Len(t, dev.Chart.Metrics[MetricVoltage], 90)
+	}
 
 	b, err := json.Marshal(response)
 	require.NoError(t, err)
 	t.Log(string(b))
 }
+
+func TestStatsSeparatesDevices(t *testing.T) {
+	stats := NewStats(testConfig(), NewMemoryStorage())
+	timestamp := time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	stats.device("balcony").push(packet.Packet{Device: "balcony", Temperature: 10, Timestamp: timestamp}, time.Time{})
+	stats.device("bedroom").push(packet.Packet{Device: "bedroom", Temperature: 20, Timestamp: timestamp}, time.Time{})
+	stats.device("").push(packet.Packet{Temperature: 30, Timestamp: timestamp}, time.Time{})
+
+	assert.Equal(t, []string{"balcony", "bedroom", defaultDevice}, stats.Devices())
+
+	current, ok := stats.Current("balcony")
+	require.True(t, ok)
+	assert.InEpsilon(t, float32(10), current.Temperature, 1e-6)
+
+	current, ok = stats.Current("bedroom")
+	require.True(t, ok)
+	assert.InEpsilon(t, float32(20), current.Temperature, 1e-6)
+
+	_, ok = stats.Current("kitchen")
+	assert.False(t, ok)
+
+	period := Query{Device: "bedroom", Resolution: ResolutionPeriod}
+	assert.Equal(t, float32(20), stats.Series(period).Metrics[MetricTemperature][0][1])
+
+	period.Device = "kitchen"
+	assert.Empty(t, stats.Series(period).Metrics[MetricTemperature])
+}
+
+func TestStatsRegister(t *testing.T) {
+	stats := NewStats(testConfig(), NewMemoryStorage())
+
+	err := stats.Register(Metric{
+		Name: "dew_point",
+		Value: func(data packet.Packet) float32 {
+			return data.Temperature - (100-data.Humidity)/5
+		},
+	})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, stats.Register(Metric{Name: MetricHumidity}), errMetricExists)
+	require.ErrorIs(t, stats.Register(Metric{Name: seriesResolutionKey}), errMetricReserved)
+
+	timestamp := time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC)
+	stats.device("balcony").push(packet.Packet{Temperature: 20, Humidity: 60, Timestamp: timestamp}, time.Time{})
+
+	require.ErrorIs(t, stats.Register(Metric{Name: "late"}), errMetricsFrozen)
+
+	series := stats.Series(Query{Device: "balcony", Resolution: ResolutionPeriod})
+	assert.Equal(t, float32(60), series.Metrics[MetricHumidity][0][1])
+	assert.Equal(t, float32(12), series.Metrics["dew_point"][0][1])
+
+	b, err := json.Marshal(series)
+	require.NoError(t, err)
+	var object map[string]json.RawMessage
+
+	require.NoError(t, json.Unmarshal(b, &object))
+	assert.Len(t, object, 7)
+	assert.JSONEq(t, `"period"`, string(object[seriesResolutionKey]))
+	assert.JSONEq(t, `[[1696147200000, 12]]`, string(object["dew_point"]))
+	assert.Contains(t, object, seriesExtremesKey)
+}
+
+func TestStatsPartialReading(t *testing.T) {
+	fields, err := packet.ParseJSONFields("temperature=temperature")
+	require.NoError(t, err)
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderJSON}, packet.DecoderOptions{JSONFields: fields})
+	require.NoError(t, err)
+
+	data := packet.Packet{Device: "bedroom"}
+	require.NoError(t, decoder.Decode([]byte(`{"temperature": 21.5, "linkquality": 120}`), &data))
+
+	stats := NewStats(testConfig(), NewMemoryStorage())
+	require.NoError(t, stats.Push(data))
+
+	now := data.Timestamp
+	series := stats.Series(Query{Device: "bedroom", Resolution: ResolutionRaw, From: now.Add(-time.Hour), To: now})
+	assert.Len(t, series.Metrics[MetricTemperature], 1)
+	assert.Empty(t, series.Metrics[MetricHumidity])
+	assert.Empty(t, series.Metrics[MetricPressure])
+	assert.Empty(t, series.Metrics[MetricVoltage])
+
+	today := stats.device("bedroom").today(now)
+	assert.Contains(t, today, MetricTemperature)
+	assert.NotContains(t, today, MetricHumidity)
+}
+
+func TestStatsExtremes(t *testing.T) {
+	stats := NewStats(testConfig(), NewMemoryStorage())
+	dev := stats.device("balcony")
+
+	now := time.Date(2023, 10, 1, 20, 0, 0, 0, time.UTC)
+	bod := beginningOfDay(now, time.UTC)
+
+	readings := []struct {
+		offset time.Duration
+		value  float32
+	}{
+		{3 * time.Hour, -4.5}, // evening wraps around midnight
+		{7 * time.Hour, 2},
+		{9 * time.Hour, 6},
+		{15 * time.Hour, 11.25},
+		{16 * time.Hour, 9},
+	}
+
+	for _, r := range readings {
+		dev.push(packet.Packet{Temperature: r.value, Timestamp: bod.Add(r.offset)}, time.Time{})
+	}
+
+	series := stats.Series(Query{Device: "balcony", Resolution: ResolutionPeriod, From: bod, To: now})
+	extremes := series.Extremes[MetricTemperature]
+	require.NotNil(t, extremes)
+
+	require.Len(t, extremes.Daily, 1)
+	assert.Equal(t, Extremes{
+		Date: bod.UnixMilli(),
+		Min:  Extreme{Value: -4.5, Timestamp: bod.Add(3 * time.Hour).UnixMilli()},
+		Max:  Extreme{Value: 11.25, Timestamp: bod.Add(15 * time.Hour).UnixMilli()},
+	}, extremes.Daily[0])
+
+	require.Len(t, extremes.Periods, 3)
+	assert.Equal(t, Extremes{
+		Period: "morning",
+		Date:   bod.UnixMilli(),
+		Min:    Extreme{Value: 2, Timestamp: bod.Add(7 * time.Hour).UnixMilli()},
+		Max:    Extreme{Value: 6, Timestamp: bod.Add(9 * time.Hour).UnixMilli()},
+	}, extremes.Periods[0])
+	assert.Equal(t, "evening", extremes.Periods[2].Period)
+
+	assert.Equal(t, extremes.Daily[0], dev.today(now)[MetricTemperature])
+
+	// tiers carry min and max in their points instead
+	assert.Nil(t, stats.Series(Query{Device: "balcony", Resolution: ResolutionHour}).Extremes)
+}
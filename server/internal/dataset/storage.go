@@ -0,0 +1,238 @@
+package dataset
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+const (
+	storageFileName    = "packets.ndjson"
+	aggregatesFileName = "aggregates.json"
+	storageFileMode    = 0o600
+	storageDirMode     = 0o750
+)
+
+// Storage persists packets so that Stats survives restarts.
+type Storage interface {
+	Append(data packet.Packet) error
+	Load(fn func(data packet.Packet)) error
+	Remove(before time.Time) error
+	// SaveAggregates replaces the encoded aggregates of Stats, LoadAggregates
+	// returns nil until they are saved.
+	SaveAggregates(data []byte) error
+	LoadAggregates() ([]byte, error)
+	Close() error
+}
+
+// memoryStorage keeps nothing, history lives only in Stats.
+type memoryStorage struct{}
+
+func NewMemoryStorage() Storage {
+	return memoryStorage{}
+}
+
+func (memoryStorage) Append(packet.Packet) error      { return nil }
+func (memoryStorage) Load(func(packet.Packet)) error  { return nil }
+func (memoryStorage) Remove(time.Time) error          { return nil }
+func (memoryStorage) SaveAggregates([]byte) error     { return nil }
+func (memoryStorage) LoadAggregates() ([]byte, error) { return nil, nil }
+func (memoryStorage) Close() error                    { return nil }
+
+// FileStorage is an append-only log of packets, one JSON document per line,
+// next to a file of the aggregates older packets were folded into.
+type FileStorage struct {
+	path           string
+	aggregatesPath string
+	file           *os.File
+	mu             sync.Mutex
+}
+
+func NewFileStorage(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, storageDirMode); err != nil {
+		return nil, fmt.Errorf("create data dir: %w", err)
+	}
+
+	s := &FileStorage{
+		path:           filepath.Join(dir, storageFileName),
+		aggregatesPath: filepath.Join(dir, aggregatesFileName),
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStorage) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, storageFileMode)
+	if err != nil {
+		return fmt.Errorf("open storage: %w", err)
+	}
+
+	s.file = file
+
+	return nil
+}
+
+func (s *FileStorage) Append(data packet.Packet) error {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("marshal packet: %w", err)
+	}
+
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(line); err != nil {
+		return fmt.Errorf("write storage: %w", err)
+	}
+
+	return nil
+}
+
+// Load calls fn for every stored packet in the order they were appended.
+// Lines that cannot be decoded, e.g. a write torn by a power loss, are skipped.
+// It does not block Append: the log only grows and Remove replaces the file,
+// so a reader sees a consistent prefix.
+func (s *FileStorage) Load(fn func(data packet.Packet)) error {
+	return scanFile(s.path, fn)
+}
+
+// ReadFileStorage reads the log kept in dir without opening it for writing,
+// so it is safe to use while the server is running.
+func ReadFileStorage(dir string, fn func(data packet.Packet)) error {
+	return scanFile(filepath.Join(dir, storageFileName), fn)
+}
+
+func scanFile(path string, fn func(data packet.Packet)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open storage: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for line := 1; scanner.Scan(); line++ {
+		var data packet.Packet
+
+		if err := json.Unmarshal(scanner.Bytes(), &data); err != nil {
+			slog.Warn("skipping corrupted storage record", "path", path, "line", line, "error", err)
+
+			continue
+		}
+
+		fn(data)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read storage: %w", err)
+	}
+
+	return nil
+}
+
+// Remove rewrites the log without packets older than before.
+func (s *FileStorage) Remove(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tmpPath := s.path + ".tmp"
+
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, storageFileMode)
+	if err != nil {
+		return fmt.Errorf("create temporary storage: %w", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+
+	var encodeErr error
+
+	err = scanFile(s.path, func(data packet.Packet) {
+		if encodeErr == nil && !data.Timestamp.Before(before) {
+			encodeErr = encoder.Encode(data)
+		}
+	})
+	if err == nil {
+		err = encodeErr
+	}
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmpPath)
+
+		return fmt.Errorf("compact storage: %w", err)
+	}
+
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("close storage: %w", err)
+	}
+
+	renameErr := os.Rename(tmpPath, s.path)
+
+	if err := s.open(); err != nil {
+		return err
+	}
+
+	if renameErr != nil {
+		return fmt.Errorf("replace storage: %w", renameErr)
+	}
+
+	return nil
+}
+
+// SaveAggregates replaces the file, a crash leaves the previous aggregates.
+func (s *FileStorage) SaveAggregates(data []byte) error {
+	tmpPath := s.aggregatesPath + ".tmp"
+
+	if err := os.WriteFile(tmpPath, data, storageFileMode); err != nil {
+		return fmt.Errorf("write aggregates: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, s.aggregatesPath); err != nil {
+		return fmt.Errorf("replace aggregates: %w", err)
+	}
+
+	return nil
+}
+
+func (s *FileStorage) LoadAggregates() ([]byte, error) {
+	data, err := os.ReadFile(s.aggregatesPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read aggregates: %w", err)
+	}
+
+	return data, nil
+}
+
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.file.Close()
+}
@@ -0,0 +1,139 @@
+package dataset //nolint:testpackage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadAll(t *testing.T, storage Storage) []packet.Packet {
+	t.Helper()
+
+	var packets []packet.Packet
+
+	err := storage.Load(func(data packet.Packet) {
+		packets = append(packets, data)
+	})
+	require.NoError(t, err)
+
+	return packets
+}
+
+func TestFileStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	for day := range 10 {
+		err := storage.Append(packet.Packet{
+			Device:      "balcony",
+			Temperature: float32(day),
+			Timestamp:   time.Date(2023, 10, day+1, 8, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, storage.Close())
+
+	storage, err = NewFileStorage(dir)
+	require.NoError(t, err)
+
+	defer storage.Close()
+
+	packets := loadAll(t, storage)
+	require.Len(t, packets, 10)
+	assert.Equal(t, "balcony", packets[0].Device)
+	assert.True(t, packets[9].Timestamp.Equal(time.Date(2023, 10, 10, 8, 0, 0, 0, time.UTC)))
+
+	require.NoError(t, storage.Remove(time.Date(2023, 10, 6, 0, 0, 0, 0, time.UTC)))
+
+	packets = loadAll(t, storage)
+	require.Len(t, packets, 5)
+	assert.InEpsilon(t, float32(5), packets[0].Temperature, 1e-6)
+
+	// appends keep working after compaction
+	require.NoError(t, storage.Append(packet.Packet{Device: "bedroom", Timestamp: time.Now()}))
+	assert.Len(t, loadAll(t, storage), 6)
+}
+
+func TestFileStorageSkipsCorruptedLines(t *testing.T) {
+	dir := t.TempDir()
+
+	content := `{"device":"balcony","timestamp":"2023-10-01T08:00:00Z","temperature":1}
+{"device":"balc
+{"device":"balcony","timestamp":"2023-10-02T08:00:00Z","temperature":2}
+`
+	err := os.WriteFile(filepath.Join(dir, storageFileName), []byte(content), storageFileMode)
+	require.NoError(t, err)
+
+	storage, err := NewFileStorage(dir)
+	require.NoError(t, err)
+
+	defer storage.Close()
+
+	assert.Len(t, loadAll(t, storage), 2)
+}
+
+func TestStatsRestore(t *testing.T) {
+	storage, err := NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	defer storage.Close()
+
+	now := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	for day := range 20 {
+		err := storage.Append(packet.Packet{
+			Device:      "balcony",
+			Temperature: float32(day),
+			Timestamp:   time.Date(2023, 10, day+1, 8, 0, 0, 0, time.UTC),
+		})
+		require.NoError(t, err)
+	}
+
+	stats := NewStats(testConfig(), storage)
+	require.NoError(t, stats.Restore(now))
+
+	current, ok := stats.Current("balcony")
+	require.True(t, ok)
+	assert.InEpsilon(t, float32(19), current.Temperature, 1e-6)
+
+	// retention is applied to memory and disk, the log keeps the raw points
+	assert.Len(t, stats.Series(Query{Device: "balcony", Resolution: ResolutionPeriod}).Metrics[MetricTemperature], 7)
+	assert.Len(t, loadAll(t, storage), 2)
+
+	require.NoError(t, stats.Push(packet.Packet{Device: "balcony", Temperature: 30, Timestamp: now}))
+
+	// the aggregates of trimmed packets come back from their own file, only
+	// packets pushed since are folded again
+	stats = NewStats(testConfig(), storage)
+	require.NoError(t, stats.Restore(now))
+
+	current, ok = stats.Current("balcony")
+	require.True(t, ok)
+	assert.InEpsilon(t, float32(30), current.Temperature, 1e-6)
+
+	day := Query{Device: "balcony", Resolution: ResolutionDay, From: now.AddDate(0, -1, 0), To: now}
+	days := stats.Series(day).Metrics[MetricTemperature]
+	require.Len(t, days, 20)
+	assert.Equal(t, 2, days[19][4])
+	assert.Equal(t, float32(24.5), days[19][1])
+
+	raw := Query{Device: "balcony", Resolution: ResolutionRaw, From: now.AddDate(0, -1, 0), To: now}
+	assert.Len(t, stats.Series(raw).Metrics[MetricTemperature], 3)
+	assert.Len(t, stats.Series(Query{Device: "balcony", Resolution: ResolutionPeriod}).Metrics[MetricTemperature], 7)
+
+	require.NoError(t, stats.remove(now.Add(testConfig().DayRetention).AddDate(0, 0, -7)))
+	assert.Empty(t, loadAll(t, storage))
+
+	stats = NewStats(testConfig(), storage)
+	require.NoError(t, stats.Restore(now.Add(testConfig().DayRetention).AddDate(0, 0, -7)))
+	assert.Len(t, stats.Series(day).Metrics[MetricTemperature], 7)
+}
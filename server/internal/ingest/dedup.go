@@ -0,0 +1,72 @@
+package ingest
+
+import (
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"temperature-sensor/internal/packet"
+)
+
+// Deduplicator drops copies of the last packet of a device received within
+// the window. Packets with a sequence are copies when the sequence repeats,
+// others when every value does. Authenticated retransmits are always copies,
+// the verifier saw their counter before.
+type Deduplicator struct {
+	next    Emitter
+	window  time.Duration
+	last    map[string]packet.Packet
+	mu      sync.Mutex
+	dropped atomic.Uint64
+}
+
+// NewDeduplicator passes every packet on when window is zero.
+func NewDeduplicator(next Emitter, window time.Duration) *Deduplicator {
+	return &Deduplicator{
+		next:   next,
+		window: window,
+		last:   make(map[string]packet.Packet),
+	}
+}
+
+// Dropped returns how many copies were dropped.
+func (d *Deduplicator) Dropped() uint64 {
+	return d.dropped.Load()
+}
+
+func (d *Deduplicator) Emit(pack packet.Packet) {
+	if pack.Retransmit || (d.window > 0 && d.duplicate(pack)) {
+		d.dropped.Add(1)
+		slog.Debug("dropped duplicate packet", "device", pack.Device, "sequence", pack.Sequence)
+
+		return
+	}
+
+	d.next.Emit(pack)
+}
+
+func (d *Deduplicator) duplicate(pack packet.Packet) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	last, ok := d.last[pack.Device]
+	if ok && pack.Timestamp.Sub(last.Timestamp) <= d.window && sameReading(last, pack) {
+		return true
+	}
+
+	d.last[pack.Device] = pack
+
+	return false
+}
+
+func sameReading(a, b packet.Packet) bool {
+	if a.Sequence != 0 || b.Sequence != 0 {
+		return a.Sequence == b.Sequence
+	}
+
+	return a.Temperature == b.Temperature &&
+		a.Humidity == b.Humidity &&
+		a.Pressure == b.Pressure &&
+		a.Voltage == b.Voltage
+}
@@ -0,0 +1,64 @@
+package ingest_test
+
+import (
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/ingest"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeduplicator(t *testing.T) {
+	var emitted sliceEmitter
+
+	dedup := ingest.NewDeduplicator(&emitted, 10*time.Second)
+	start := time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	packets := []packet.Packet{
+		{Device: "balcony", Timestamp: start, Sequence: 1, Temperature: 20},
+		// a retransmission may carry a fresh measurement
+		{Device: "balcony", Timestamp: start.Add(time.Second), Sequence: 1, Temperature: 20.1},
+		{Device: "balcony", Timestamp: start.Add(2 * time.Second), Sequence: 2, Temperature: 20.1},
+		{Device: "bedroom", Timestamp: start, Temperature: 22},
+		{Device: "bedroom", Timestamp: start.Add(time.Second), Temperature: 22},
+		{Device: "bedroom", Timestamp: start.Add(2 * time.Second), Temperature: 22.5},
+		// outside the window the same values are a new reading
+		{Device: "bedroom", Timestamp: start.Add(time.Minute), Temperature: 22.5},
+	}
+
+	for _, p := range packets {
+		dedup.Emit(p)
+	}
+
+	assert.Equal(t, []packet.Packet{packets[0], packets[2], packets[3], packets[5], packets[6]}, []packet.Packet(emitted))
+	assert.Equal(t, uint64(2), dedup.Dropped())
+}
+
+func TestDeduplicatorDisabled(t *testing.T) {
+	var emitted sliceEmitter
+
+	dedup := ingest.NewDeduplicator(&emitted, 0)
+	p := packet.Packet{Device: "balcony", Sequence: 1}
+
+	dedup.Emit(p)
+	dedup.Emit(p)
+
+	assert.Len(t, emitted, 2)
+	assert.Zero(t, dedup.Dropped())
+}
+
+func TestDeduplicatorRetransmit(t *testing.T) {
+	var emitted sliceEmitter
+
+	dedup := ingest.NewDeduplicator(&emitted, 0)
+	start := time.Date(2023, 10, 1, 8, 0, 0, 0, time.UTC)
+
+	dedup.Emit(packet.Packet{Device: "balcony", Timestamp: start, Sequence: 1})
+	// a replayed frame arrives long after any window
+	dedup.Emit(packet.Packet{Device: "balcony", Timestamp: start.Add(time.Hour), Sequence: 1, Retransmit: true})
+
+	assert.Len(t, emitted, 1)
+	assert.Equal(t, uint64(1), dedup.Dropped())
+}
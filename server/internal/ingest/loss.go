@@ -0,0 +1,123 @@
+package ingest
+
+import (
+	"log/slog"
+	"sync"
+
+	"temperature-sensor/internal/packet"
+)
+
+// Emitter receives packets from an ingest stage.
+type Emitter interface {
+	Emit(pack packet.Packet)
+}
+
+// Link describes how many packets of a device made it to the server. Only
+// packets with a sequence are counted.
+type Link struct {
+	// Expected is the number of sequences the device sent as far as the
+	// server can tell, Received of them arrived.
+	Expected uint64 `json:"expected"`
+	Received uint64 `json:"received"`
+	Lost     uint64 `json:"lost"`
+	// Retransmits repeat the last sequence and are not counted as received.
+	Retransmits uint64 `json:"retransmits"`
+	// Resets count sequences going back, like after a sensor power loss.
+	Resets       uint64  `json:"resets"`
+	LastSequence uint32  `json:"last_sequence"`
+	LossRate     float64 `json:"loss_rate"`
+}
+
+func (l *Link) receive(sequence uint32) {
+	switch {
+	case l.Received == 0 || sequence < l.LastSequence:
+		if l.Received != 0 {
+			l.Resets++
+		}
+
+		l.Expected++
+	case sequence == l.LastSequence:
+		l.Retransmits++
+
+		return
+	default:
+		gap := uint64(sequence - l.LastSequence - 1)
+		l.Lost += gap
+		l.Expected += gap + 1
+	}
+
+	l.Received++
+	l.LastSequence = sequence
+	l.LossRate = float64(l.Lost) / float64(l.Expected)
+}
+
+// LossTracker counts sequence gaps per device and passes every packet on.
+type LossTracker struct {
+	next  Emitter
+	links map[string]*Link
+	mu    sync.Mutex
+}
+
+func NewLossTracker(next Emitter) *LossTracker {
+	return &LossTracker{
+		next:  next,
+		links: make(map[string]*Link),
+	}
+}
+
+func (t *LossTracker) Emit(pack packet.Packet) {
+	if pack.Sequence != 0 {
+		t.track(pack)
+	}
+
+	t.next.Emit(pack)
+}
+
+func (t *LossTracker) track(pack packet.Packet) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	link, ok := t.links[pack.Device]
+	if !ok {
+		link = &Link{}
+		t.links[pack.Device] = link
+	}
+
+	lost, resets := link.Lost, link.Resets
+
+	link.receive(pack.Sequence)
+
+	if link.Lost > lost {
+		slog.Debug("sequence gap", "device", pack.Device, "lost", link.Lost-lost, "sequence", pack.Sequence)
+	}
+
+	if link.Resets > resets {
+		slog.Info("sequence reset", "device", pack.Device, "sequence", pack.Sequence)
+	}
+}
+
+// Link returns the counters of one device.
+func (t *LossTracker) Link(device string) (Link, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	link, ok := t.links[device]
+	if !ok {
+		return Link{}, false
+	}
+
+	return *link, true
+}
+
+// Links returns the counters of every device keyed by id.
+func (t *LossTracker) Links() map[string]Link {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	links := make(map[string]Link, len(t.links))
+	for device, link := range t.links {
+		links[device] = *link
+	}
+
+	return links
+}
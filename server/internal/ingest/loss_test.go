@@ -0,0 +1,48 @@
+package ingest_test
+
+import (
+	"testing"
+
+	"temperature-sensor/internal/ingest"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type sliceEmitter []packet.Packet
+
+func (e *sliceEmitter) Emit(pack packet.Packet) {
+	*e = append(*e, pack)
+}
+
+func TestLossTracker(t *testing.T) {
+	var emitted sliceEmitter
+
+	tracker := ingest.NewLossTracker(&emitted)
+
+	for _, sequence := range []uint32{5, 6, 6, 9, 10, 1, 2} {
+		tracker.Emit(packet.Packet{Device: "balcony", Sequence: sequence})
+	}
+
+	// packets without a sequence pass through untracked
+	tracker.Emit(packet.Packet{Device: "kitchen"})
+
+	assert.Len(t, emitted, 8)
+
+	link, ok := tracker.Link("balcony")
+	require.True(t, ok)
+	assert.Equal(t, ingest.Link{
+		Expected:     8, // 5..10 and 1..2
+		Received:     6,
+		Lost:         2, // 7 and 8
+		Retransmits:  1,
+		Resets:       1,
+		LastSequence: 2,
+		LossRate:     0.25,
+	}, link)
+
+	_, ok = tracker.Link("kitchen")
+	assert.False(t, ok)
+	assert.Len(t, tracker.Links(), 1)
+}
@@ -0,0 +1,163 @@
+package mqtt //nolint:testpackage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+)
+
+const (
+	packetConnect    = 1
+	packetPublish    = 3
+	packetSubscribe  = 8
+	packetPingReq    = 12
+	packetDisconnect = 14
+)
+
+// fakeBroker accepts every connection and subscription, enough for the
+// client to connect and subscribe.
+type fakeBroker struct {
+	addr       string
+	conns      chan net.Conn
+	subscribed chan string
+	published  chan publishedMessage
+}
+
+type publishedMessage struct {
+	topic   string
+	qos     byte
+	retain  bool
+	payload []byte
+}
+
+func newFakeBroker(t *testing.T, listener net.Listener) *fakeBroker {
+	t.Helper()
+
+	b := &fakeBroker{
+		addr:       listener.Addr().String(),
+		conns:      make(chan net.Conn, 16),
+		subscribed: make(chan string, 16),
+		published:  make(chan publishedMessage, 16),
+	}
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			b.conns <- conn
+
+			go b.handle(conn)
+		}
+	}()
+
+	return b
+}
+
+func (b *fakeBroker) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+
+	for {
+		header, body, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+
+		var reply []byte
+
+		switch header >> 4 {
+		case packetConnect:
+			reply = []byte{0x20, 0x02, 0x00, 0x00}
+		case packetPublish:
+			reply = b.publish(header, body)
+		case packetSubscribe:
+			reply = b.subscribe(body)
+		case packetPingReq:
+			reply = []byte{0xd0, 0x00}
+		case packetDisconnect:
+			return
+		}
+
+		if _, err := conn.Write(reply); err != nil {
+			return
+		}
+	}
+}
+
+// subscribe grants every topic of a SUBSCRIBE with its QoS.
+func (b *fakeBroker) subscribe(body []byte) []byte {
+	granted := []byte{}
+
+	for rest := body[2:]; len(rest) >= 2; {
+		size := int(binary.BigEndian.Uint16(rest))
+		b.subscribed <- string(rest[2 : 2+size])
+		granted = append(granted, rest[2+size])
+		rest = rest[3+size:]
+	}
+
+	reply := []byte{0x90, byte(2 + len(granted)), body[0], body[1]}
+
+	return append(reply, granted...)
+}
+
+// publish records a PUBLISH and acknowledges QoS 1.
+func (b *fakeBroker) publish(header byte, body []byte) []byte {
+	size := int(binary.BigEndian.Uint16(body))
+	msg := publishedMessage{
+		topic:  string(body[2 : 2+size]),
+		qos:    header >> 1 & 0x03,
+		retain: header&0x01 != 0,
+	}
+
+	rest := body[2+size:]
+
+	var reply []byte
+	if msg.qos > 0 {
+		reply = []byte{0x40, 0x02, rest[0], rest[1]}
+		rest = rest[2:]
+	}
+
+	msg.payload = rest
+	b.published <- msg
+
+	return reply
+}
+
+func readPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the remaining length is a varint
+	length, shift := 0, 0
+
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		length |= int(b&0x7f) << shift
+		shift += 7
+
+		if b&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, err
+	}
+
+	return header, body, nil
+}
@@ -0,0 +1,239 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+)
+
+const (
+	// expireChecks is how often per expiry period devices are checked.
+	expireChecks = 4
+
+	availabilityOnline  = "online"
+	availabilityOffline = "offline"
+
+	nodePrefix   = "temperature_sensor_"
+	manufacturer = "temperature-sensor"
+)
+
+var (
+	errDiscoveryTopic  = errors.New("discovery needs a publish topic with " + devicePlaceholder)
+	errDiscoveryExpire = errors.New("discovery expiry must be positive")
+)
+
+// invalidIDChars are not allowed in discovery node and object ids.
+//
+//nolint:gochecknoglobals
+var invalidIDChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// entity is one value of a Reading shown in Home Assistant, metric is the
+// packet value it shows, empty for one every reading has.
+type entity struct {
+	key         string
+	name        string
+	deviceClass string
+	unit        string
+	field       string
+	metric      string
+	diagnostic  bool
+}
+
+//nolint:gochecknoglobals
+var entities = []entity{
+	{
+		key: "temperature", name: "Temperature", deviceClass: "temperature", unit: "°C",
+		field: "temperature_c", metric: packet.FieldTemperature,
+	},
+	{
+		key: "humidity", name: "Humidity", deviceClass: "humidity", unit: "%",
+		field: "humidity_percent", metric: packet.FieldHumidity,
+	},
+	{
+		key: "pressure", name: "Pressure", deviceClass: "atmospheric_pressure", unit: "hPa",
+		field: "pressure_hpa", metric: packet.FieldPressure,
+	},
+	{
+		key: "battery", name: "Battery", deviceClass: "battery", unit: "%",
+		field: "battery_percent", metric: packet.FieldVoltage, diagnostic: true,
+	},
+	{
+		key: "voltage", name: "Battery voltage", deviceClass: "voltage", unit: "mV",
+		field: "voltage_mv", metric: packet.FieldVoltage, diagnostic: true,
+	},
+	{key: "last_seen", name: "Last seen", deviceClass: "timestamp", field: "timestamp", diagnostic: true},
+}
+
+type discoveryDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+}
+
+// discoveryConfig is the Home Assistant MQTT sensor configuration.
+type discoveryConfig struct {
+	Name              string          `json:"name"`
+	UniqueID          string          `json:"unique_id"`
+	StateTopic        string          `json:"state_topic"`
+	ValueTemplate     string          `json:"value_template"`
+	DeviceClass       string          `json:"device_class"`
+	UnitOfMeasurement string          `json:"unit_of_measurement,omitempty"`
+	StateClass        string          `json:"state_class,omitempty"`
+	EntityCategory    string          `json:"entity_category,omitempty"`
+	AvailabilityTopic string          `json:"availability_topic"`
+	Device            discoveryDevice `json:"device"`
+}
+
+// discovery announces devices and tracks their availability, it is used by
+// the Publish loop only.
+type discovery struct {
+	prefix   string
+	expire   time.Duration
+	lastSeen map[string]time.Time
+	// announced holds the config topics of every device on the broker.
+	announced map[string]map[string]bool
+	online    map[string]bool
+}
+
+func newDiscovery(cfg config.Discovery, publish config.Publish) (*discovery, error) {
+	if !cfg.Enable {
+		return nil, nil //nolint:nilnil
+	}
+
+	if !strings.Contains(publish.Topic, devicePlaceholder) {
+		return nil, errDiscoveryTopic
+	}
+
+	if cfg.Expire <= 0 {
+		return nil, errDiscoveryExpire
+	}
+
+	return &discovery{
+		prefix:    cfg.Prefix,
+		expire:    cfg.Expire,
+		lastSeen:  make(map[string]time.Time),
+		announced: make(map[string]map[string]bool),
+		online:    make(map[string]bool),
+	}, nil
+}
+
+func availabilityTopic(stateTopic string) string {
+	return stateTopic + "/availability"
+}
+
+func nodeID(device string) string {
+	return nodePrefix + invalidIDChars.ReplaceAllString(device, "_")
+}
+
+// configs returns the discovery messages of the device of data keyed by
+// topic, values data lacks get no entity.
+func (d *discovery) configs(stateTopic string, data packet.Packet) map[string]discoveryConfig {
+	device := data.Device
+	node := nodeID(device)
+	configs := make(map[string]discoveryConfig, len(entities))
+
+	for _, e := range entities {
+		if e.metric != "" && !data.Has(e.metric) {
+			continue
+		}
+
+		c := discoveryConfig{
+			Name:              e.name,
+			UniqueID:          node + "_" + e.key,
+			StateTopic:        stateTopic,
+			ValueTemplate:     "{{ value_json." + e.field + " }}",
+			DeviceClass:       e.deviceClass,
+			UnitOfMeasurement: e.unit,
+			AvailabilityTopic: availabilityTopic(stateTopic),
+			Device: discoveryDevice{
+				Identifiers:  []string{node},
+				Name:         device,
+				Manufacturer: manufacturer,
+			},
+		}
+
+		if e.unit != "" {
+			c.StateClass = "measurement"
+		}
+
+		if e.diagnostic {
+			c.EntityCategory = "diagnostic"
+		}
+
+		configs[fmt.Sprintf("%s/sensor/%s/%s/config", d.prefix, node, e.key)] = c
+	}
+
+	return configs
+}
+
+// known adds the devices seen before a restart as online, like their
+// retained availability, so they expire when they do not report again.
+func (d *discovery) known(lastSeen map[string]time.Time) {
+	for device, t := range lastSeen {
+		d.lastSeen[device] = t
+		d.online[device] = true
+	}
+}
+
+// seen announces the entities of a reading its device has none for yet and
+// marks the device online.
+func (d *discovery) seen(s *Service, data packet.Packet, now time.Time) {
+	device := data.Device
+	stateTopic := publishTopic(s.publishCfg.Topic, device)
+	d.lastSeen[device] = now
+
+	if d.announced[device] == nil {
+		d.announced[device] = make(map[string]bool)
+	}
+
+	announced := 0
+
+	for topic, c := range d.configs(stateTopic, data) {
+		if d.announced[device][topic] {
+			continue
+		}
+
+		payload, err := json.Marshal(c)
+		if err != nil {
+			slog.Error("failed to encode discovery config", "error", err)
+
+			return
+		}
+
+		if s.send(topic, payload, true) {
+			d.announced[device][topic] = true
+			announced++
+		}
+	}
+
+	if announced > 0 {
+		slog.Info("device announced to home assistant", "device", device, "entities", announced)
+	}
+
+	if !d.online[device] {
+		d.online[device] = s.send(availabilityTopic(stateTopic), []byte(availabilityOnline), true)
+	}
+}
+
+// expireDevices marks devices without a recent reading offline.
+func (d *discovery) expireDevices(s *Service, now time.Time) {
+	for device, lastSeen := range d.lastSeen {
+		if !d.online[device] || now.Sub(lastSeen) < d.expire {
+			continue
+		}
+
+		topic := availabilityTopic(publishTopic(s.publishCfg.Topic, device))
+		if s.send(topic, []byte(availabilityOffline), true) {
+			d.online[device] = false
+
+			slog.Info("device unavailable", "device", device, "last_seen", lastSeen)
+		}
+	}
+}
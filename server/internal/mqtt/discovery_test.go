@@ -0,0 +1,150 @@
+package mqtt //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiscoveryValidate(t *testing.T) {
+	_, err := newDiscovery(config.Discovery{Enable: true, Expire: time.Minute}, config.Publish{Topic: "sensors/state"})
+	require.ErrorIs(t, err, errDiscoveryTopic)
+
+	_, err = newDiscovery(config.Discovery{Enable: true}, config.Publish{Topic: "sensors/{device}"})
+	require.ErrorIs(t, err, errDiscoveryExpire)
+
+	d, err := newDiscovery(config.Discovery{}, config.Publish{})
+	require.NoError(t, err)
+	assert.Nil(t, d)
+}
+
+func TestDiscoveryConfigs(t *testing.T) {
+	d := &discovery{prefix: "homeassistant"}
+	configs := d.configs("sensors/espnow_balcony/state", packet.Packet{Device: "espnow/balcony"})
+	require.Len(t, configs, len(entities))
+
+	c, ok := configs["homeassistant/sensor/temperature_sensor_espnow_balcony/temperature/config"]
+	require.True(t, ok)
+	assert.Equal(t, discoveryConfig{
+		Name:              "Temperature",
+		UniqueID:          "temperature_sensor_espnow_balcony_temperature",
+		StateTopic:        "sensors/espnow_balcony/state",
+		ValueTemplate:     "{{ value_json.temperature_c }}",
+		DeviceClass:       "temperature",
+		UnitOfMeasurement: "°C",
+		StateClass:        "measurement",
+		AvailabilityTopic: "sensors/espnow_balcony/state/availability",
+		Device: discoveryDevice{
+			Identifiers:  []string{"temperature_sensor_espnow_balcony"},
+			Name:         "espnow/balcony",
+			Manufacturer: manufacturer,
+		},
+	}, c)
+
+	c = configs["homeassistant/sensor/temperature_sensor_espnow_balcony/last_seen/config"]
+	assert.Empty(t, c.StateClass)
+	assert.Equal(t, "diagnostic", c.EntityCategory)
+
+	// every value template names a field of the published reading
+	var reading map[string]any
+
+	payload, err := json.Marshal(NewReading(packet.Packet{}))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(payload, &reading))
+
+	for _, e := range entities {
+		assert.Contains(t, reading, e.field)
+	}
+
+	// a temperature only sensor gets no entities for the values it lacks
+	configs = d.configs("sensors/bedroom/state", packet.Packet{
+		Device:  "bedroom",
+		Missing: []string{packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage},
+	})
+	assert.Len(t, configs, 2)
+	assert.Contains(t, configs, "homeassistant/sensor/temperature_sensor_bedroom/temperature/config")
+	assert.Contains(t, configs, "homeassistant/sensor/temperature_sensor_bedroom/last_seen/config")
+}
+
+func TestDiscoveryPublish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	broker := newFakeBroker(t, listener)
+
+	srv, err := New(config.MQTT{
+		Broker:            "tcp://" + broker.addr,
+		ClientID:          "test",
+		KeepAliveDuration: time.Minute,
+		PingTimeout:       time.Second,
+		RetryMin:          10 * time.Millisecond,
+		RetryMax:          10 * time.Millisecond,
+		Publish:           config.Publish{Topic: "sensors/{device}/state"},
+		Discovery:         config.Discovery{Enable: true, Prefix: "homeassistant", Expire: 100 * time.Millisecond},
+	}, &sliceEmitter{}, nil, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	readings := make(chanSubscriber)
+
+	// attic reported before a restart and not since
+	lastSeen := map[string]time.Time{"attic": time.Now().Add(-time.Hour)}
+
+	go func() { _ = srv.Run(ctx) }()
+	go func() { _ = srv.Publish(ctx, readings, lastSeen) }()
+
+	require.Eventually(t, func() bool { return srv.State().Connected }, 5*time.Second, 5*time.Millisecond)
+
+	msg := receive(t, broker.published)
+	assert.Equal(t, publishedMessage{topic: "sensors/attic/state/availability", retain: true, payload: []byte("offline")}, msg)
+
+	// a temperature only reading announces its entities only
+	readings <- packet.Packet{
+		Device: "balcony", Timestamp: time.Now(), Temperature: 20,
+		Missing: []string{packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage},
+	}
+
+	receiveConfigs(t, broker.published, "balcony", 2)
+
+	msg = receive(t, broker.published)
+	assert.Equal(t, publishedMessage{topic: "sensors/balcony/state/availability", retain: true, payload: []byte("online")}, msg)
+
+	msg = receive(t, broker.published)
+	assert.Equal(t, "sensors/balcony/state", msg.topic)
+
+	// no reading within the expiry
+	msg = receive(t, broker.published)
+	assert.Equal(t, publishedMessage{topic: "sensors/balcony/state/availability", retain: true, payload: []byte("offline")}, msg)
+
+	// the next reading brings it back and announces only the values it adds
+	readings <- packet.Packet{Device: "balcony", Timestamp: time.Now(), Temperature: 20}
+
+	receiveConfigs(t, broker.published, "balcony", len(entities)-2)
+
+	msg = receive(t, broker.published)
+	assert.Equal(t, []byte("online"), msg.payload)
+
+	require.NoError(t, srv.Close())
+}
+
+func receiveConfigs(t *testing.T, published chan publishedMessage, device string, n int) {
+	t.Helper()
+
+	for range n {
+		msg := receive(t, published)
+		assert.True(t, strings.HasPrefix(msg.topic, "homeassistant/sensor/temperature_sensor_"+device+"/"), msg.topic)
+		assert.True(t, strings.HasSuffix(msg.topic, "/config"), msg.topic)
+		assert.True(t, msg.retain)
+	}
+}
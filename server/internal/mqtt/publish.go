@@ -0,0 +1,162 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+)
+
+const (
+	devicePlaceholder = "{device}"
+	publishTimeout    = 10 * time.Second
+	maxQoS            = 2
+	// fullChargeVoltage in mV is 100%, as on the dashboard.
+	fullChargeVoltage = 4200
+)
+
+var (
+	errInvalidQoS           = errors.New("invalid QoS, want 0, 1 or 2")
+	errWildcardPublishTopic = errors.New("publish topic must not contain + or #")
+)
+
+// Reading is the JSON published for every decoded packet, values the
+// source did not send are left out.
+type Reading struct {
+	Device          string    `json:"device"`
+	Timestamp       time.Time `json:"timestamp"`
+	TemperatureC    *float64  `json:"temperature_c,omitempty"`
+	HumidityPercent *float64  `json:"humidity_percent,omitempty"`
+	PressureHPa     *float64  `json:"pressure_hpa,omitempty"`
+	PressureMmHg    *float64  `json:"pressure_mmhg,omitempty"`
+	VoltageMV       *float64  `json:"voltage_mv,omitempty"`
+	BatteryPercent  *float64  `json:"battery_percent,omitempty"`
+}
+
+// round returns v rounded to hundredths, nil when p lacks metric.
+func round(p packet.Packet, metric string, v float32) *float64 {
+	if !p.Has(metric) {
+		return nil
+	}
+
+	return new(math.Round(float64(v)*100) / 100)
+}
+
+func NewReading(p packet.Packet) Reading {
+	return Reading{
+		Device:          p.Device,
+		Timestamp:       p.Timestamp,
+		TemperatureC:    round(p, packet.FieldTemperature, p.Temperature),
+		HumidityPercent: round(p, packet.FieldHumidity, p.Humidity),
+		PressureHPa:     round(p, packet.FieldPressure, packet.MmHgToPascal(p.Pressure)/100),
+		PressureMmHg:    round(p, packet.FieldPressure, p.Pressure),
+		VoltageMV:       round(p, packet.FieldVoltage, p.Voltage),
+		BatteryPercent:  round(p, packet.FieldVoltage, min(p.Voltage/fullChargeVoltage*100, 100)),
+	}
+}
+
+type eventSubscriber interface {
+	Subscribe() chan packet.Packet
+	Unsubscribe(ch chan packet.Packet)
+}
+
+func validatePublish(cfg config.Publish) error {
+	if cfg.QoS < 0 || cfg.QoS > maxQoS {
+		return fmt.Errorf("%w: %d", errInvalidQoS, cfg.QoS)
+	}
+
+	if strings.ContainsAny(cfg.Topic, "+#") {
+		return fmt.Errorf("%w: %s", errWildcardPublishTopic, cfg.Topic)
+	}
+
+	return nil
+}
+
+// publishTopic fills in the device, characters with a meaning in topics are
+// replaced so a device stays one level.
+func publishTopic(topic, device string) string {
+	device = strings.NewReplacer("/", "_", "+", "_", "#", "_").Replace(device)
+
+	return strings.ReplaceAll(topic, devicePlaceholder, device)
+}
+
+// Publish sends every reading of events to the publish topic of its device
+// until ctx is done. Readings are dropped while the broker is not connected,
+// the retained one is replaced by the next reading. With discovery devices
+// are announced on their first reading and go offline when they stop,
+// lastSeen has the devices known from before the start.
+func (s *Service) Publish(ctx context.Context, events eventSubscriber, lastSeen map[string]time.Time) error {
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	var expire <-chan time.Time
+
+	if s.discovery != nil {
+		s.discovery.known(lastSeen)
+
+		ticker := time.NewTicker(s.discovery.expire / expireChecks)
+		defer ticker.Stop()
+
+		expire = ticker.C
+	}
+
+	for {
+		select {
+		case data := <-ch:
+			if s.discovery != nil {
+				s.discovery.seen(s, data, time.Now())
+			}
+
+			s.publish(data)
+		case now := <-expire:
+			s.discovery.expireDevices(s, now)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *Service) publish(data packet.Packet) {
+	payload, err := json.Marshal(NewReading(data))
+	if err != nil {
+		slog.Error("failed to encode reading", "error", err)
+
+		return
+	}
+
+	s.send(publishTopic(s.publishCfg.Topic, data.Device), payload, s.publishCfg.Retain)
+}
+
+// send publishes without waiting for the broker, it reports false when
+// not connected.
+func (s *Service) send(topic string, payload []byte, retain bool) bool {
+	if !s.client.IsConnectionOpen() {
+		slog.Debug("mqtt not connected, message not published", "topic", topic)
+
+		return false
+	}
+
+	token := s.client.Publish(topic, byte(s.publishCfg.QoS), retain, payload)
+
+	// waiting here would drop readings the emitter sends meanwhile
+	go func() {
+		if !token.WaitTimeout(publishTimeout) {
+			slog.Warn("mqtt publish timed out", "topic", topic)
+
+			return
+		}
+
+		if err := token.Error(); err != nil {
+			slog.Warn("mqtt publish failed", "topic", topic, "error", err)
+		}
+	}()
+
+	return true
+}
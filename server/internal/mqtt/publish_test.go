@@ -0,0 +1,103 @@
+package mqtt //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chanSubscriber hands every reading to Publish, a send blocks until it is
+// taken where the EventEmitter drops it while Publish is busy.
+type chanSubscriber chan packet.Packet
+
+func (c chanSubscriber) Subscribe() chan packet.Packet  { return c }
+func (c chanSubscriber) Unsubscribe(chan packet.Packet) {}
+
+func TestPublishTopic(t *testing.T) {
+	assert.Equal(t, "sensors/balcony/state", publishTopic("sensors/{device}/state", "balcony"))
+	assert.Equal(t, "sensors/espnow_balcony/state", publishTopic("sensors/{device}/state", "espnow/balcony"))
+	assert.Equal(t, "sensors/state", publishTopic("sensors/state", "balcony"))
+}
+
+func TestPublishValidate(t *testing.T) {
+	_, err := New(config.MQTT{Broker: "tcp://localhost:1883", Publish: config.Publish{Topic: "sensors/+", QoS: 1}},
+		&sliceEmitter{}, nil, nil)
+	require.ErrorIs(t, err, errWildcardPublishTopic)
+
+	_, err = New(config.MQTT{Broker: "tcp://localhost:1883", Publish: config.Publish{Topic: "sensors", QoS: 3}},
+		&sliceEmitter{}, nil, nil)
+	require.ErrorIs(t, err, errInvalidQoS)
+}
+
+func TestPublish(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	broker := newFakeBroker(t, listener)
+
+	srv, err := New(config.MQTT{
+		Broker:            "tcp://" + broker.addr,
+		ClientID:          "test",
+		KeepAliveDuration: time.Minute,
+		PingTimeout:       time.Second,
+		RetryMin:          10 * time.Millisecond,
+		RetryMax:          10 * time.Millisecond,
+		Publish:           config.Publish{Topic: "sensors/{device}/state", QoS: 1, Retain: true},
+	}, &sliceEmitter{}, nil, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	readings := make(chanSubscriber)
+
+	go func() { _ = srv.Run(ctx) }()
+	go func() { _ = srv.Publish(ctx, readings, nil) }()
+
+	require.Eventually(t, func() bool { return srv.State().Connected }, 5*time.Second, 5*time.Millisecond)
+
+	timestamp := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	readings <- packet.Packet{
+		Device:      "balcony",
+		Timestamp:   timestamp,
+		Temperature: 21.456,
+		Humidity:    48,
+		Pressure:    750,
+		Voltage:     3012,
+	}
+
+	msg := receive(t, broker.published)
+	assert.Equal(t, "sensors/balcony/state", msg.topic)
+	assert.Equal(t, byte(1), msg.qos)
+	assert.True(t, msg.retain)
+
+	var reading Reading
+	require.NoError(t, json.Unmarshal(msg.payload, &reading))
+	assert.Equal(t, Reading{
+		Device:          "balcony",
+		Timestamp:       timestamp,
+		TemperatureC:    new(21.46),
+		HumidityPercent: new(48.0),
+		PressureHPa:     new(999.92),
+		PressureMmHg:    new(750.0),
+		VoltageMV:       new(3012.0),
+		BatteryPercent:  new(71.71),
+	}, reading)
+
+	// values the source did not send are left out
+	assert.Equal(t, Reading{Device: "balcony", TemperatureC: new(20.5)}, NewReading(packet.Packet{
+		Device:      "balcony",
+		Temperature: 20.5,
+		Missing:     []string{packet.FieldHumidity, packet.FieldPressure, packet.FieldVoltage},
+	}))
+
+	require.NoError(t, srv.Close())
+}
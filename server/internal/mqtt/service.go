@@ -3,46 +3,126 @@ package mqtt
 import (
 	"context"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"temperature-sensor/internal/backoff"
+	"temperature-sensor/internal/capture"
 	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/packet"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 )
 
+// Subscription routes the messages of a topic filter to a decoder.
+type Subscription struct {
+	Topic string
+	QoS   byte
+	// DeviceSegment is the topic segment used as device id, negative
+	// indexes count from the end.
+	DeviceSegment int
+	Decoder       packet.Decoder
+}
+
+// State is the connection to the broker.
+type State struct {
+	Connected bool `json:"connected"`
+	// Since is when the connection was made or lost.
+	Since time.Time `json:"since,omitzero"`
+	// Attempts counts the failed connection attempts since, the client
+	// keeps trying while disconnected.
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+}
+
 type Service struct {
-	topic   string
-	client  mqtt.Client
-	emitter eventEmitter
+	subscriptions []Subscription
+	client        mqtt.Client
+	emitter       eventEmitter
+	recorder      *capture.Writer
+	retryMin      time.Duration
+	retryMax      time.Duration
+	cleanSession  bool
+	publishCfg    config.Publish
+	discovery     *discovery
+	// closed stops Run once Close is called
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu    sync.Mutex
+	state State
 }
 
 type eventEmitter interface {
 	Emit(pack packet.Packet)
 }
 
-func New(cfg config.MQTT, emitter eventEmitter) *Service {
+// New configures the client, messages are recorded to recorder when it is
+// not nil.
+func New(
+	cfg config.MQTT, emitter eventEmitter, subscriptions []Subscription, recorder *capture.Writer,
+) (*Service, error) {
+	tlsConf, err := tlsConfig(cfg.Broker, cfg.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+
+	if err := validatePublish(cfg.Publish); err != nil {
+		return nil, fmt.Errorf("publish: %w", err)
+	}
+
+	disc, err := newDiscovery(cfg.Discovery, cfg.Publish)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
 	srv := &Service{
-		topic:   cfg.Topic,
-		emitter: emitter,
+		subscriptions: subscriptions,
+		emitter:       emitter,
+		recorder:      recorder,
+		retryMin:      cfg.RetryMin,
+		retryMax:      cfg.RetryMax,
+		cleanSession:  cfg.CleanSession,
+		publishCfg:    cfg.Publish,
+		discovery:     disc,
+		closed:        make(chan struct{}),
 	}
 
-	opts := mqtt.NewClientOptions().AddBroker(cfg.Broker).SetClientID(cfg.ClientID)
+	opts := mqtt.NewClientOptions().AddBroker(cfg.Broker).SetClientID(clientID(cfg.ClientID))
 	opts.SetUsername(cfg.Username)
 	opts.SetPassword(cfg.Password)
 	opts.SetKeepAlive(cfg.KeepAliveDuration)
-	opts.SetDefaultPublishHandler(srv.messageHandler())
+	opts.SetCleanSession(cfg.CleanSession)
+	// Run retries the first connection, the client reconnects after that
+	opts.SetConnectRetry(false)
+	opts.SetAutoReconnect(true)
+	opts.SetMaxReconnectInterval(cfg.RetryMax)
+	opts.SetOnConnectHandler(srv.subscribe)
+
+	if tlsConf != nil {
+		opts.SetTLSConfig(tlsConf)
+	}
+
+	opts.SetDefaultPublishHandler(srv.route)
 	opts.SetPingTimeout(cfg.PingTimeout)
 	opts.SetConnectionNotificationHandler(func(_ mqtt.Client, notification mqtt.ConnectionNotification) {
 		switch n := notification.(type) {
 		case mqtt.ConnectionNotificationConnected:
 			slog.Debug("connected")
+			srv.setState(true, nil)
 		case mqtt.ConnectionNotificationConnecting:
 			slog.Debug("connecting", "isReconnect", n.IsReconnect, "attempt", n.Attempt)
 		case mqtt.ConnectionNotificationFailed:
 			slog.Debug("connection failed", "reason", n.Reason)
+			srv.failed(n.Reason)
 		case mqtt.ConnectionNotificationLost:
-			slog.Debug("connection lost", "reason", n.Reason)
+			slog.Warn("mqtt connection lost", "reason", n.Reason)
+			srv.setState(false, n.Reason)
 		case mqtt.ConnectionNotificationBroker:
 			slog.Debug("broker connection", "broker", n.Broker.String())
 		case mqtt.ConnectionNotificationBrokerFailed:
@@ -52,16 +132,59 @@ func New(cfg config.MQTT, emitter eventEmitter) *Service {
 
 	srv.client = mqtt.NewClient(opts)
 
-	return srv
+	return srv, nil
 }
 
-func (s *Service) Run(ctx context.Context) error {
-	if token := s.client.Connect(); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("connect: %w", token.Error())
+// clientID defaults to a name derived from the host, stable across restarts
+// so the broker resumes the session.
+func clientID(id string) string {
+	if id != "" {
+		return id
 	}
 
-	if token := s.client.Subscribe(s.topic, 0, nil); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("subscribe: %w", token.Error())
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return "temperature-sensor-" + host
+}
+
+// Run connects to the broker, retrying with backoff until the broker is up,
+// and blocks until ctx is done or the service is closed. Subscriptions are
+// made on every connect.
+func (s *Service) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-s.closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	retry := backoff.New(s.retryMin, s.retryMax)
+
+	for {
+		token := s.client.Connect()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-token.Done():
+		}
+
+		if token.Error() == nil {
+			break
+		}
+
+		slog.Warn("mqtt connect failed, retrying", "error", token.Error(), "attempts", s.State().Attempts)
+
+		if !retry.Wait(ctx) {
+			return nil
+		}
 	}
 
 	<-ctx.Done()
@@ -69,28 +192,108 @@ func (s *Service) Run(ctx context.Context) error {
 	return nil
 }
 
-func (s *Service) Close() error {
-	if !s.client.IsConnectionOpen() {
-		return nil
+// State returns the current connection state.
+func (s *Service) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.state
+}
+
+// setState records a change of the connection, err is why it was lost.
+func (s *Service) setState(connected bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state = State{Connected: connected, Since: time.Now()}
+	if err != nil {
+		s.state.LastError = err.Error()
 	}
+}
+
+// failed records a failed connection attempt.
+func (s *Service) failed(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	if token := s.client.Unsubscribe(s.topic); token.Wait() && token.Error() != nil {
-		return fmt.Errorf("unsubscribe: %w", token.Error())
+	if s.state.Since.IsZero() {
+		s.state.Since = time.Now()
 	}
 
-	s.client.Disconnect(250)
+	s.state.Attempts++
+	s.state.LastError = err.Error()
+}
+
+// subscribe (re)subscribes every topic once connected, a clean session
+// forgets them and a resumed one may have lost them too.
+func (s *Service) subscribe(client mqtt.Client) {
+	for _, sub := range s.subscriptions {
+		token := client.Subscribe(sub.Topic, sub.QoS, s.messageHandler(sub))
+		if token.Wait() && token.Error() != nil {
+			slog.Error("mqtt subscribe failed", "topic", sub.Topic, "error", token.Error())
+
+			continue
+		}
+
+		slog.Debug("mqtt subscribed", "topic", sub.Topic, "qos", sub.QoS)
+	}
+}
+
+// route handles messages without a handler of their own, a resumed session
+// delivers queued messages before the subscriptions are made again.
+func (s *Service) route(client mqtt.Client, msg mqtt.Message) {
+	for _, sub := range s.subscriptions {
+		if topicMatches(sub.Topic, msg.Topic()) {
+			s.messageHandler(sub)(client, msg)
+
+			return
+		}
+	}
+
+	slog.Debug("mqtt message without subscription", "topic", msg.Topic())
+}
+
+// Close stops Run and disconnects, Disconnect also ends a connect or
+// reconnect in progress.
+func (s *Service) Close() error {
+	s.closeOnce.Do(func() { close(s.closed) })
+
+	defer s.client.Disconnect(250)
+
+	// a persistent session keeps the subscriptions, the broker queues
+	// messages for them until the next connect
+	if s.cleanSession && s.client.IsConnectionOpen() {
+		topics := make([]string, 0, len(s.subscriptions))
+		for _, sub := range s.subscriptions {
+			topics = append(topics, sub.Topic)
+		}
+
+		if token := s.client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+			return fmt.Errorf("unsubscribe: %w", token.Error())
+		}
+	}
 
 	return nil
 }
 
-func (s *Service) messageHandler() mqtt.MessageHandler {
+func (s *Service) messageHandler(sub Subscription) mqtt.MessageHandler {
 	return func(_ mqtt.Client, msg mqtt.Message) {
 		raw := msg.Payload()
 		rawHex := hex.EncodeToString(raw)
 		slog.Debug("mqtt payload received", "topic", msg.Topic(), "raw_hex", rawHex, "size", len(raw))
 
-		var p packet.Packet
-		if err := packet.EncodeMQTTPacket(raw, &p); err != nil {
+		p := packet.Packet{Device: deviceFromTopic(msg.Topic(), sub.DeviceSegment)}
+		s.recorder.Record(capture.TransportMQTT, msg.Topic(), p.Device, raw)
+
+		err := sub.Decoder.Decode(raw, &p)
+		if errors.Is(err, packet.ErrUnrecognized) {
+			// status messages share topics with readings
+			slog.Debug("ignored mqtt payload", "topic", msg.Topic(), "error", err)
+
+			return
+		}
+
+		if err != nil {
 			slog.Warn("failed to parse mqtt payload", "topic", msg.Topic(), "error", err, "size", len(raw), "raw_hex", rawHex)
 
 			return
@@ -100,3 +303,38 @@ func (s *Service) messageHandler() mqtt.MessageHandler {
 		s.emitter.Emit(p)
 	}
 }
+
+// topicMatches reports whether topic matches the filter with its + and #
+// wildcards.
+func topicMatches(filter, topic string) bool {
+	filterLevels := strings.Split(filter, "/")
+	topicLevels := strings.Split(topic, "/")
+
+	for i, level := range filterLevels {
+		if level == "#" {
+			return true
+		}
+
+		if i >= len(topicLevels) || (level != "+" && level != topicLevels[i]) {
+			return false
+		}
+	}
+
+	return len(filterLevels) == len(topicLevels)
+}
+
+// deviceFromTopic returns the topic segment at index, negative indexes count
+// from the end. The whole topic is used when the index is out of range.
+func deviceFromTopic(topic string, index int) string {
+	segments := strings.Split(topic, "/")
+
+	if index < 0 {
+		index += len(segments)
+	}
+
+	if index < 0 || index >= len(segments) || segments[index] == "" {
+		return topic
+	}
+
+	return segments[index]
+}
@@ -0,0 +1,201 @@
+package mqtt //nolint:testpackage
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeviceFromTopic(t *testing.T) {
+	tests := []struct {
+		topic    string
+		index    int
+		expected string
+	}{
+		{"espnow/balcony", -1, "balcony"},
+		{"sensors/bedroom/espnow", 1, "bedroom"},
+		{"sensors/bedroom/espnow", -2, "bedroom"},
+		{"espnow", -1, "espnow"},
+		{"espnow/balcony", 5, "espnow/balcony"},
+		{"espnow/", -1, "espnow/"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, deviceFromTopic(test.topic, test.index), "topic: %q", test.topic)
+	}
+}
+
+type fakeMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m fakeMessage) Duplicate() bool   { return false }
+func (m fakeMessage) Qos() byte         { return 0 }
+func (m fakeMessage) Retained() bool    { return false }
+func (m fakeMessage) Topic() string     { return m.topic }
+func (m fakeMessage) MessageID() uint16 { return 0 }
+func (m fakeMessage) Payload() []byte   { return m.payload }
+func (m fakeMessage) Ack()              {}
+
+type sliceEmitter []packet.Packet
+
+func (e *sliceEmitter) Emit(pack packet.Packet) {
+	*e = append(*e, pack)
+}
+
+func TestMessageHandlerSubscription(t *testing.T) {
+	fields, err := packet.ParseJSONFields("temperature=temperature,humidity=humidity")
+	require.NoError(t, err)
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderJSON}, packet.DecoderOptions{JSONFields: fields})
+	require.NoError(t, err)
+
+	var emitted sliceEmitter
+
+	srv := &Service{emitter: &emitted}
+	handler := srv.messageHandler(Subscription{Topic: "zigbee2mqtt/+", DeviceSegment: 1, Decoder: decoder})
+
+	handler(nil, fakeMessage{topic: "zigbee2mqtt/kitchen", payload: []byte(`{"temperature":21.3,"humidity":40}`)})
+	handler(nil, fakeMessage{topic: "zigbee2mqtt/bridge", payload: []byte("online")})
+
+	require.Len(t, emitted, 1)
+	assert.Equal(t, "kitchen", emitted[0].Device)
+	assert.InDelta(t, 21.3, emitted[0].Temperature, 1e-6)
+}
+
+func TestTopicMatches(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		expected      bool
+	}{
+		{"espnow/balcony", "espnow/balcony", true},
+		{"espnow/+", "espnow/balcony", true},
+		{"espnow/+", "espnow/balcony/raw", false},
+		{"espnow/#", "espnow/balcony/raw", true},
+		{"espnow/#", "espnow", true},
+		{"+/+/SENSOR", "tele/kitchen/SENSOR", true},
+		{"+/+/SENSOR", "tele/kitchen/STATE", false},
+		{"espnow/balcony/raw", "espnow/balcony", false},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, topicMatches(test.filter, test.topic), "%s %s", test.filter, test.topic)
+	}
+}
+
+func TestRouteQueuedMessage(t *testing.T) {
+	fields, err := packet.ParseJSONFields("temperature=temperature")
+	require.NoError(t, err)
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderJSON}, packet.DecoderOptions{JSONFields: fields})
+	require.NoError(t, err)
+
+	var emitted sliceEmitter
+
+	srv := &Service{
+		emitter:       &emitted,
+		subscriptions: []Subscription{{Topic: "zigbee2mqtt/+", DeviceSegment: 1, Decoder: decoder}},
+	}
+
+	srv.route(nil, fakeMessage{topic: "zigbee2mqtt/kitchen", payload: []byte(`{"temperature":21}`)})
+	srv.route(nil, fakeMessage{topic: "other/kitchen", payload: []byte(`{"temperature":21}`)})
+
+	require.Len(t, emitted, 1)
+	assert.Equal(t, "kitchen", emitted[0].Device)
+}
+
+func TestRunReconnects(t *testing.T) {
+	// reserve a port the broker starts on later
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	srv, err := New(config.MQTT{
+		Broker:            "tcp://" + addr,
+		ClientID:          "test",
+		KeepAliveDuration: time.Minute,
+		PingTimeout:       time.Second,
+		RetryMin:          10 * time.Millisecond,
+		RetryMax:          50 * time.Millisecond,
+	}, &sliceEmitter{}, []Subscription{{Topic: "espnow/+", DeviceSegment: -1}}, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return srv.State().Attempts >= 2 }, 5*time.Second, 5*time.Millisecond)
+	assert.False(t, srv.State().Connected)
+	assert.NotEmpty(t, srv.State().LastError)
+
+	listener, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+
+	broker := newFakeBroker(t, listener)
+
+	assert.Equal(t, "espnow/+", receive(t, broker.subscribed))
+	require.Eventually(t, func() bool { return srv.State().Connected }, 5*time.Second, 5*time.Millisecond)
+	assert.Zero(t, srv.State().Attempts)
+
+	// the broker drops the connection, the client reconnects and subscribes again
+	receive(t, broker.conns).Close()
+	assert.Equal(t, "espnow/+", receive(t, broker.subscribed))
+
+	cancel()
+	require.NoError(t, <-done)
+	require.NoError(t, srv.Close())
+}
+
+func TestCloseStopsRun(t *testing.T) {
+	// no broker listens on the reserved port
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	addr := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	srv, err := New(config.MQTT{
+		Broker:            "tcp://" + addr,
+		ClientID:          "test",
+		KeepAliveDuration: time.Minute,
+		PingTimeout:       time.Second,
+		RetryMin:          10 * time.Millisecond,
+		RetryMax:          50 * time.Millisecond,
+	}, &sliceEmitter{}, nil, nil)
+	require.NoError(t, err)
+
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Run(t.Context()) }()
+
+	require.Eventually(t, func() bool { return srv.State().Attempts >= 1 }, 5*time.Second, 5*time.Millisecond)
+
+	require.NoError(t, srv.Close())
+	require.NoError(t, receive(t, done))
+}
+
+func receive[T any](t *testing.T, ch chan T) T {
+	t.Helper()
+
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+
+		var zero T
+
+		return zero
+	}
+}
@@ -0,0 +1,74 @@
+package mqtt
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"temperature-sensor/internal/config"
+)
+
+var (
+	errNoCertificates = errors.New("no certificates found")
+	errCertWithoutKey = errors.New("client certificate and key must be given together")
+	errNotTLSBroker   = errors.New("TLS options need a TLS broker")
+)
+
+// tlsSchemes are the broker schemes paho connects to over TLS.
+//
+//nolint:gochecknoglobals
+var tlsSchemes = []string{"ssl", "tls", "mqtts", "tcps"}
+
+// tlsConfig builds the client TLS configuration, nil when no option is set.
+func tlsConfig(broker string, cfg config.TLS) (*tls.Config, error) {
+	if !cfg.Configured() {
+		return nil, nil //nolint:nilnil
+	}
+
+	u, err := url.Parse(broker)
+	if err != nil {
+		return nil, fmt.Errorf("parse broker: %w", err)
+	}
+
+	if !slices.Contains(tlsSchemes, u.Scheme) {
+		return nil, fmt.Errorf("%w, one of %s://: %s", errNotTLSBroker, strings.Join(tlsSchemes, "://, "), broker)
+	}
+
+	conf := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.ServerName,
+		InsecureSkipVerify: cfg.InsecureSkipVerify, //nolint:gosec // opt-in for self-signed brokers
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA: %w", err)
+		}
+
+		conf.RootCAs = x509.NewCertPool()
+		if !conf.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %s", errNoCertificates, cfg.CAFile)
+		}
+	}
+
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return nil, errCertWithoutKey
+	}
+
+	if cfg.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	return conf, nil
+}
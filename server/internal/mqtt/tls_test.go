@@ -0,0 +1,215 @@
+package mqtt //nolint:testpackage
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testServerName = "broker.test"
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	file string
+}
+
+func newTestCA(t *testing.T, dir string) testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, "ca.pem")
+	writePEM(t, file, "CERTIFICATE", der)
+
+	return testCA{cert: cert, key: key, file: file}
+}
+
+// issue writes a certificate signed by the CA and its key, returning both
+// paths.
+func (ca testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "PRIVATE KEY", keyDER)
+
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, path, kind string, der []byte) {
+	t.Helper()
+
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: der}), 0o600))
+}
+
+func connect(t *testing.T, broker string, tlsCfg config.TLS) error {
+	t.Helper()
+
+	srv, err := New(config.MQTT{
+		Broker:            broker,
+		ClientID:          "test",
+		KeepAliveDuration: time.Minute,
+		PingTimeout:       time.Second,
+		TLS:               tlsCfg,
+	}, &sliceEmitter{}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	token := srv.client.Connect()
+	if !token.WaitTimeout(5 * time.Second) {
+		t.Fatal("connect timed out")
+	}
+
+	if token.Error() == nil {
+		srv.client.Disconnect(0)
+	}
+
+	return token.Error()
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, testServerName, x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, dir, "sensor-server", x509.ExtKeyUsageClientAuth)
+
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	})
+	require.NoError(t, err)
+
+	addr := newFakeBroker(t, listener).addr
+
+	err = connect(t, "ssl://"+addr, config.TLS{
+		CAFile:     ca.file,
+		CertFile:   clientCert,
+		KeyFile:    clientKey,
+		ServerName: testServerName,
+	})
+	require.NoError(t, err)
+
+	// the broker refuses clients without a certificate
+	err = connect(t, "ssl://"+addr, config.TLS{CAFile: ca.file, ServerName: testServerName})
+	require.Error(t, err)
+
+	// the broker certificate is not valid for the address
+	err = connect(t, "ssl://"+addr, config.TLS{CAFile: ca.file, CertFile: clientCert, KeyFile: clientKey})
+	require.Error(t, err)
+}
+
+func TestTLSVerify(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	serverCert, serverKey := ca.issue(t, dir, testServerName, x509.ExtKeyUsageServerAuth)
+
+	cert, err := tls.LoadX509KeyPair(serverCert, serverKey)
+	require.NoError(t, err)
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0",
+		&tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}})
+	require.NoError(t, err)
+
+	addr := newFakeBroker(t, listener).addr
+
+	// the test CA is not in the system pool
+	err = connect(t, "mqtts://"+addr, config.TLS{ServerName: testServerName})
+	require.Error(t, err)
+
+	err = connect(t, "mqtts://"+addr, config.TLS{InsecureSkipVerify: true})
+	require.NoError(t, err)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir)
+	clientCert, _ := ca.issue(t, dir, "sensor-server", x509.ExtKeyUsageClientAuth)
+
+	notPEM := filepath.Join(dir, "empty.pem")
+	require.NoError(t, os.WriteFile(notPEM, []byte("not a certificate"), 0o600))
+
+	tests := []struct {
+		name   string
+		broker string
+		cfg    config.TLS
+		err    error
+	}{
+		{"plain broker", "tcp://localhost:1883", config.TLS{CAFile: ca.file}, errNotTLSBroker},
+		{"cert without key", "ssl://localhost:8883", config.TLS{CertFile: clientCert}, errCertWithoutKey},
+		{"empty CA", "ssl://localhost:8883", config.TLS{CAFile: notPEM}, errNoCertificates},
+		{"missing CA", "ssl://localhost:8883", config.TLS{CAFile: filepath.Join(dir, "missing.pem")}, os.ErrNotExist},
+	}
+
+	for _, test := range tests {
+		_, err := tlsConfig(test.broker, test.cfg)
+		require.ErrorIs(t, err, test.err, test.name)
+	}
+
+	_, err := tlsConfig("tcp://localhost:1883", config.TLS{CAFile: ca.file})
+	require.ErrorContains(t, err, "ssl://, tls://, mqtts://, tcps://")
+
+	conf, err := tlsConfig("tcp://localhost:1883", config.TLS{})
+	require.NoError(t, err)
+	assert.Nil(t, conf)
+}
@@ -0,0 +1,224 @@
+package packet
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// TagSize is the length of the truncated HMAC-SHA256 tag authenticated
+	// packets end with.
+	TagSize = 8
+
+	epochSize = 4
+)
+
+var (
+	errUnknownKey  = errors.New("no key for device")
+	errInvalidTag  = errors.New("invalid authentication tag")
+	errReplayed    = errors.New("replayed counter")
+	errMissingAuth = errors.New("missing authentication")
+	// errRetransmit repeats the last counter, the packet is passed on marked
+	// as a retransmit rather than rejected.
+	errRetransmit = errors.New("retransmitted counter")
+)
+
+// Tag returns the truncated HMAC-SHA256 of message.
+func Tag(key, message []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write(message)
+
+	return mac.Sum(nil)[:TagSize]
+}
+
+// Counter is the last authenticated packet of a device. Epoch counts the
+// boots of the sensor and is kept in its flash, Count restarts with each
+// epoch when the sensor loses power.
+type Counter struct {
+	Epoch uint32 `json:"epoch"`
+	Count uint32 `json:"count"`
+}
+
+// CounterStore keeps the counters of a Verifier across restarts.
+type CounterStore interface {
+	Load() (map[string]Counter, error)
+	Save(counters map[string]Counter) error
+}
+
+// Verifier authenticates packets with per-device shared keys. The epoch of a
+// device must not go down and within an epoch the counter must go up.
+// Sensors retransmit a reading with the same counter, such packets are
+// marked Retransmit and never stored, so a replayed frame cannot add a
+// reading either.
+type Verifier struct {
+	keys     map[string][]byte
+	counters map[string]Counter
+	store    CounterStore
+	// dirty is set while counters have changed since they were saved
+	dirty    bool
+	mu       sync.Mutex
+	saveMu   sync.Mutex
+	rejected atomic.Uint64
+}
+
+func NewVerifier(keys map[string][]byte) *Verifier {
+	return &Verifier{
+		keys:     keys,
+		counters: make(map[string]Counter, len(keys)),
+	}
+}
+
+// Persist loads the counters of store, Save and SaveEvery write them back.
+// Without it counters start over on restart and a frame captured before
+// is accepted again.
+func (v *Verifier) Persist(store CounterStore) error {
+	counters, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for device, counter := range counters {
+		if last, ok := v.counters[device]; !ok || last.before(counter) {
+			v.counters[device] = counter
+		}
+	}
+
+	v.store = store
+
+	return nil
+}
+
+// Save writes the counters to the store of Persist if they changed since the
+// last save.
+func (v *Verifier) Save() error {
+	v.saveMu.Lock()
+	defer v.saveMu.Unlock()
+
+	v.mu.Lock()
+
+	if v.store == nil || !v.dirty {
+		v.mu.Unlock()
+
+		return nil
+	}
+
+	counters := maps.Clone(v.counters)
+	v.dirty = false
+
+	v.mu.Unlock()
+
+	if err := v.store.Save(counters); err != nil {
+		v.mu.Lock()
+		v.dirty = true
+		v.mu.Unlock()
+
+		return err
+	}
+
+	return nil
+}
+
+// SaveEvery saves the counters every interval and once more when ctx is
+// done. Frames counted after the last save are accepted again after a crash.
+func (v *Verifier) SaveEvery(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return v.Save()
+		case <-ticker.C:
+			if err := v.Save(); err != nil {
+				slog.ErrorContext(ctx, "failed to save auth counters", "error", err)
+			}
+		}
+	}
+}
+
+// Rejected returns how many packets failed authentication.
+func (v *Verifier) Rejected() uint64 {
+	return v.rejected.Load()
+}
+
+// authenticate verifies a packet that fully decoded, so a frame that fails
+// to decode never takes its counter. A retransmit is marked on p.
+func (v *Verifier) authenticate(device string, counter Counter, message, tag []byte, p *Packet) error {
+	err := v.verify(device, counter, message, tag)
+	if err != nil && !errors.Is(err, errRetransmit) {
+		return err
+	}
+
+	p.Retransmit = err != nil
+
+	return nil
+}
+
+// verify reports errRetransmit for a repeated counter, the only error that
+// does not count as rejected.
+func (v *Verifier) verify(device string, counter Counter, message, tag []byte) error {
+	err := v.check(device, counter, message, tag)
+	if err != nil && !errors.Is(err, errRetransmit) {
+		v.rejected.Add(1)
+	}
+
+	return err
+}
+
+func (v *Verifier) check(device string, counter Counter, message, tag []byte) error {
+	key, ok := v.keys[device]
+	if !ok {
+		return fmt.Errorf("%w: %s", errUnknownKey, device)
+	}
+
+	if !hmac.Equal(Tag(key, message), tag) {
+		return fmt.Errorf("%w: device %s", errInvalidTag, device)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if last, ok := v.counters[device]; ok && !last.before(counter) {
+		if counter == last {
+			return errRetransmit
+		}
+
+		return fmt.Errorf("%w: device %s epoch %d counter %d, last epoch %d counter %d, "+
+			"resync a sensor whose flash was erased",
+			errReplayed, device, counter.Epoch, counter.Count, last.Epoch, last.Count)
+	}
+
+	v.counters[device] = counter
+	v.dirty = true
+
+	return nil
+}
+
+// before reports whether c was authenticated before next: an older epoch,
+// or a lower count in the same one.
+func (c Counter) before(next Counter) bool {
+	if c.Epoch != next.Epoch {
+		return c.Epoch < next.Epoch
+	}
+
+	return c.Count < next.Count
+}
+
+// Reject counts a packet that could not be authenticated at all, like a
+// legacy packet while keys are configured.
+func (v *Verifier) Reject() error {
+	v.rejected.Add(1)
+
+	return errMissingAuth
+}
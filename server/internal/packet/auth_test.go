@@ -0,0 +1,184 @@
+package packet_test
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"temperature-sensor/internal/packet"
+)
+
+var testKey = []byte("0123456789abcdef") //nolint:gochecknoglobals
+
+func signedFrame(device string, epoch, sequence uint32, key []byte) []byte {
+	data := testFrame(device, sequence)
+	data = binary.LittleEndian.AppendUint32(data, epoch)
+
+	return append(data, packet.Tag(key, data)...)
+}
+
+func signedMQTTPacket(epoch, counter uint32, key []byte) []byte {
+	data := make([]byte, 12)
+	data[0] = 0x7E
+	binary.LittleEndian.PutUint16(data[1:3], 2345)
+	binary.LittleEndian.PutUint16(data[3:5], 5678)
+	data[5], data[6], data[7] = 0x01, 0x8B, 0xCD // 101325 Pa
+	binary.LittleEndian.PutUint16(data[8:10], 3300)
+	binary.LittleEndian.PutUint16(data[10:12], crc16LEForTest(data[1:10]))
+
+	data = binary.LittleEndian.AppendUint32(data, counter)
+	data = binary.LittleEndian.AppendUint32(data, epoch)
+
+	return append(data, packet.Tag(key, data)...)
+}
+
+func TestEncodeUDPFrameAuthenticated(t *testing.T) {
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+
+	var pack packet.Packet
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 5, testKey), &pack, v))
+	assert.Equal(t, "balcony", pack.Device)
+	assert.Equal(t, uint32(5), pack.Sequence)
+	assert.False(t, pack.Retransmit)
+
+	// retransmissions and replays of the last frame repeat the counter, they
+	// are marked instead of rejected
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 5, testKey), &pack, v))
+	assert.True(t, pack.Retransmit)
+
+	// a tag is ignored without a verifier
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 1, testKey), &pack, nil))
+
+	tests := map[string]struct {
+		data []byte
+		err  string
+	}{
+		"replayed":       {signedFrame("balcony", 1, 4, testKey), "replayed counter"},
+		"wrong key":      {signedFrame("balcony", 1, 6, []byte("fedcba9876543210")), "invalid authentication tag"},
+		"unknown device": {signedFrame("kitchen", 1, 6, testKey), "no key for device"},
+		"unsigned":       {testFrame("balcony", 6), "missing authentication"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := packet.EncodeUDPFrame(tt.data, &pack, v)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	assert.Equal(t, uint64(len(tests)), v.Rejected())
+}
+
+func TestEncodeMQTTPacketAuthenticated(t *testing.T) {
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+
+	pack := packet.Packet{Device: "balcony"}
+
+	require.NoError(t, packet.EncodeMQTTPacket(signedMQTTPacket(1, 10, testKey), &pack, v))
+	assert.Equal(t, uint32(10), pack.Sequence)
+	assert.InEpsilon(t, 23.45, pack.Temperature, 1e-6)
+
+	require.NoError(t, packet.EncodeMQTTPacket(signedMQTTPacket(1, 10, testKey), &pack, v))
+	assert.True(t, pack.Retransmit)
+
+	err := packet.EncodeMQTTPacket(signedMQTTPacket(1, 9, testKey), &pack, v)
+	require.ErrorContains(t, err, "replayed counter")
+
+	err = packet.EncodeMQTTPacket(signedMQTTPacket(1, 11, testKey)[:12], &pack, v)
+	require.ErrorContains(t, err, "missing authentication")
+
+	pack.Device = "kitchen"
+	err = packet.EncodeMQTTPacket(signedMQTTPacket(1, 11, testKey), &pack, v)
+	require.ErrorContains(t, err, "no key for device")
+
+	assert.Equal(t, uint64(3), v.Rejected())
+}
+
+func TestVerifierPersist(t *testing.T) {
+	store := packet.NewCounterFile(t.TempDir())
+
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+	require.NoError(t, v.Persist(store))
+
+	var pack packet.Packet
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 5, testKey), &pack, v))
+
+	// counters are saved in batches
+	counters, err := store.Load()
+	require.NoError(t, err)
+	assert.Empty(t, counters)
+
+	require.NoError(t, v.Save())
+
+	counters, err = store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]packet.Counter{"balcony": {Epoch: 1, Count: 5}}, counters)
+
+	// after a restart a captured frame is still a replay
+	v = packet.NewVerifier(map[string][]byte{"balcony": testKey})
+	require.NoError(t, v.Persist(store))
+
+	err = packet.EncodeUDPFrame(signedFrame("balcony", 1, 4, testKey), &pack, v)
+	require.ErrorContains(t, err, "replayed counter")
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 5, testKey), &pack, v))
+	assert.True(t, pack.Retransmit)
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 6, testKey), &pack, v))
+	assert.False(t, pack.Retransmit)
+}
+
+func TestVerifierEpoch(t *testing.T) {
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+
+	var pack packet.Packet
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 3, 500, testKey), &pack, v))
+
+	// the sensor lost power, its counter starts over in the next epoch
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 4, 1, testKey), &pack, v))
+	assert.False(t, pack.Retransmit)
+
+	// frames captured in an earlier epoch stay replays, whatever their counter
+	err := packet.EncodeUDPFrame(signedFrame("balcony", 3, 501, testKey), &pack, v)
+	require.ErrorContains(t, err, "replayed counter")
+
+	require.NoError(t, packet.EncodeMQTTPacket(signedMQTTPacket(4, 2, testKey), &packet.Packet{Device: "balcony"}, v))
+
+	assert.Equal(t, uint64(1), v.Rejected())
+}
+
+func TestCounterFileLoadsPlainCounters(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "auth-counters.json"), []byte(`{"balcony":5}`), 0o600))
+
+	counters, err := packet.NewCounterFile(dir).Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]packet.Counter{"balcony": {Count: 5}}, counters)
+}
+
+func TestVerifierSkipsUndecodedFrames(t *testing.T) {
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+
+	// the tag is valid but the frame is not, its counter stays unused
+	data := testFrame("balcony", 5)
+	data[len(data)-3] ^= 0xff
+	data = binary.LittleEndian.AppendUint32(data, 1)
+	data = append(data, packet.Tag(testKey, data)...)
+
+	var pack packet.Packet
+
+	err := packet.EncodeUDPFrame(data, &pack, v)
+	require.ErrorContains(t, err, "invalid frame crc")
+
+	require.NoError(t, packet.EncodeUDPFrame(signedFrame("balcony", 1, 5, testKey), &pack, v))
+	assert.False(t, pack.Retransmit)
+	assert.Equal(t, uint64(0), v.Rejected())
+}
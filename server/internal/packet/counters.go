@@ -0,0 +1,86 @@
+package packet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	counterFileName = "auth-counters.json"
+	counterFileMode = 0o600
+	counterDirMode  = 0o750
+)
+
+// CounterFile is a CounterStore in a JSON object of device counters.
+// Counters saved as plain numbers before epochs belong to epoch 0.
+type CounterFile struct {
+	path string
+}
+
+func NewCounterFile(dir string) CounterFile {
+	return CounterFile{path: filepath.Join(dir, counterFileName)}
+}
+
+// Load returns no counters while the file does not exist.
+func (f CounterFile) Load() (map[string]Counter, error) {
+	data, err := os.ReadFile(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]Counter{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("read counters: %w", err)
+	}
+
+	counters := make(map[string]Counter)
+	if err := json.Unmarshal(data, &counters); err != nil {
+		return nil, fmt.Errorf("decode counters: %w", err)
+	}
+
+	return counters, nil
+}
+
+// Save replaces the file, a crash leaves the previous counters.
+func (f CounterFile) Save(counters map[string]Counter) error {
+	data, err := json.Marshal(counters)
+	if err != nil {
+		return fmt.Errorf("encode counters: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(f.path), counterDirMode); err != nil {
+		return fmt.Errorf("create counters dir: %w", err)
+	}
+
+	tmpPath := f.path + ".tmp"
+
+	if err := os.WriteFile(tmpPath, data, counterFileMode); err != nil {
+		return fmt.Errorf("write counters: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, f.path); err != nil {
+		return fmt.Errorf("replace counters: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Counter) UnmarshalJSON(data []byte) error {
+	var count uint32
+	if err := json.Unmarshal(data, &count); err == nil {
+		*c = Counter{Count: count}
+
+		return nil
+	}
+
+	type plain Counter
+
+	if err := json.Unmarshal(data, (*plain)(c)); err != nil {
+		return fmt.Errorf("counter: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,202 @@
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Names of the built-in decoders.
+const (
+	DecoderLegacyUDP     = "legacy-udp"
+	DecoderUDPFrame      = "udp-frame"
+	DecoderESPNowFrame   = "espnow-frame"
+	DecoderSerialLogLine = "serial-log-line"
+	DecoderJSON          = "json"
+)
+
+var (
+	// ErrUnrecognized is returned by decoders for data in another format,
+	// a Chain then tries the next decoder.
+	ErrUnrecognized = errors.New("unrecognized format")
+
+	errUnknownDecoder = errors.New("unknown decoder")
+	errDecoderExists  = errors.New("decoder already registered")
+	errNoDecoders     = errors.New("at least one decoder is required")
+)
+
+// Decoder turns a message of a transport into a packet. p.Device holds the
+// device the transport attributes the message to, decoders that read a
+// device id from the message replace it.
+type Decoder interface {
+	Decode(data []byte, p *Packet) error
+}
+
+type DecoderFunc func(data []byte, p *Packet) error
+
+func (f DecoderFunc) Decode(data []byte, p *Packet) error {
+	return f(data, p)
+}
+
+// DecoderOptions configure a decoder for one source.
+type DecoderOptions struct {
+	// Verifier authenticates packets, nil accepts unauthenticated ones.
+	Verifier *Verifier
+	// Tag marks the reading lines of a serial log.
+	Tag string
+	// Names maps sender MAC addresses of serial log lines to device ids.
+	Names map[string]string
+	// JSONFields map JSON payloads to metrics, see ParseJSONFields.
+	JSONFields []JSONField
+}
+
+// NewDecoderFunc creates a named decoder.
+type NewDecoderFunc func(opts DecoderOptions) Decoder
+
+type registry struct {
+	decoders map[string]NewDecoderFunc
+	mu       sync.RWMutex
+}
+
+//nolint:gochecknoglobals
+var decoders = &registry{
+	decoders: map[string]NewDecoderFunc{
+		DecoderLegacyUDP:     newLegacyUDPDecoder,
+		DecoderUDPFrame:      newUDPFrameDecoder,
+		DecoderESPNowFrame:   newESPNowFrameDecoder,
+		DecoderSerialLogLine: newSerialLogLineDecoder,
+		DecoderJSON:          newJSONDecoder,
+	},
+}
+
+func (r *registry) lookup(name string) (NewDecoderFunc, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	fn, ok := r.decoders[name]
+
+	return fn, ok
+}
+
+// RegisterDecoder adds a decoder that sources can select by name.
+func RegisterDecoder(name string, fn NewDecoderFunc) error {
+	decoders.mu.Lock()
+	defer decoders.mu.Unlock()
+
+	if _, ok := decoders.decoders[name]; ok {
+		return fmt.Errorf("%w: %s", errDecoderExists, name)
+	}
+
+	decoders.decoders[name] = fn
+
+	return nil
+}
+
+// Decoders returns the sorted names of the registered decoders.
+func Decoders() []string {
+	decoders.mu.RLock()
+	defer decoders.mu.RUnlock()
+
+	names := make([]string, 0, len(decoders.decoders))
+	for name := range decoders.decoders {
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return names
+}
+
+// NewDecoder returns the named decoders as a Chain.
+func NewDecoder(names []string, opts DecoderOptions) (Decoder, error) {
+	if len(names) == 0 {
+		return nil, errNoDecoders
+	}
+
+	chain := make(Chain, 0, len(names))
+
+	for _, name := range names {
+		fn, ok := decoders.lookup(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: %s, known: %s", errUnknownDecoder, name, strings.Join(Decoders(), ", "))
+		}
+
+		chain = append(chain, fn(opts))
+	}
+
+	if len(chain) == 1 {
+		return chain[0], nil
+	}
+
+	return chain, nil
+}
+
+// Chain tries decoders in order until one recognizes the data.
+type Chain []Decoder
+
+func (c Chain) Decode(data []byte, p *Packet) error {
+	errs := make([]error, 0, len(c))
+
+	for _, d := range c {
+		decoded := *p
+
+		err := d.Decode(data, &decoded)
+		if err == nil {
+			*p = decoded
+
+			return nil
+		}
+
+		if !errors.Is(err, ErrUnrecognized) {
+			return err
+		}
+
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func newLegacyUDPDecoder(opts DecoderOptions) Decoder {
+	return DecoderFunc(func(data []byte, p *Packet) error {
+		if len(data) != udpLegacyPacketSize {
+			return fmt.Errorf("%w: %w: got %d, want %d",
+				ErrUnrecognized, errInvalidUDPPacketSize, len(data), udpLegacyPacketSize)
+		}
+
+		// legacy packets cannot carry a tag
+		if opts.Verifier != nil {
+			return opts.Verifier.Reject()
+		}
+
+		return EncodeUDPPacket(data, p)
+	})
+}
+
+func newUDPFrameDecoder(opts DecoderOptions) Decoder {
+	return DecoderFunc(func(data []byte, p *Packet) error {
+		if !IsUDPFrame(data) {
+			return fmt.Errorf("%w: %w", ErrUnrecognized, errInvalidFrameMagic)
+		}
+
+		return EncodeUDPFrame(data, p, opts.Verifier)
+	})
+}
+
+func newESPNowFrameDecoder(opts DecoderOptions) Decoder {
+	return DecoderFunc(func(data []byte, p *Packet) error {
+		if len(data) == 0 || data[0] != espNowStartFlag {
+			return fmt.Errorf("%w: %w", ErrUnrecognized, errInvalidESPNowStartFlag)
+		}
+
+		return EncodeMQTTPacket(data, p, opts.Verifier)
+	})
+}
+
+func newSerialLogLineDecoder(opts DecoderOptions) Decoder {
+	return DecoderFunc(func(data []byte, p *Packet) error {
+		return EncodeSerialLine(string(data), opts.Tag, opts.Names, p)
+	})
+}
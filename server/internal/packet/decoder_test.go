@@ -0,0 +1,104 @@
+package packet_test
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"temperature-sensor/internal/packet"
+)
+
+func legacyPacket(values ...float32) []byte {
+	data := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+
+	return data
+}
+
+func TestDecoderChain(t *testing.T) {
+	decoder, err := packet.NewDecoder([]string{packet.DecoderUDPFrame, packet.DecoderLegacyUDP}, packet.DecoderOptions{})
+	require.NoError(t, err)
+
+	p := packet.Packet{Device: "192.168.1.10"}
+	require.NoError(t, decoder.Decode(testFrame("balcony", 3), &p))
+	assert.Equal(t, "balcony", p.Device)
+	assert.Equal(t, uint32(3), p.Sequence)
+
+	p = packet.Packet{Device: "192.168.1.10"}
+	require.NoError(t, decoder.Decode(legacyPacket(21.5, 40, 100000, 3300), &p))
+	assert.Equal(t, "192.168.1.10", p.Device)
+	assert.InDelta(t, 21.5, p.Temperature, 1e-6)
+
+	// a recognized but broken frame is not passed on to the next decoder
+	broken := testFrame("balcony", 3)
+	broken[len(broken)-1] ^= 0xff
+
+	p = packet.Packet{Device: "192.168.1.10"}
+	err = decoder.Decode(broken, &p)
+	require.ErrorContains(t, err, "invalid frame crc")
+	assert.NotErrorIs(t, err, packet.ErrUnrecognized)
+	assert.Equal(t, packet.Packet{Device: "192.168.1.10"}, p)
+
+	err = decoder.Decode([]byte{1, 2, 3}, &p)
+	require.ErrorIs(t, err, packet.ErrUnrecognized)
+}
+
+func TestDecoderLegacyRejectedWithVerifier(t *testing.T) {
+	v := packet.NewVerifier(map[string][]byte{"balcony": testKey})
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderLegacyUDP}, packet.DecoderOptions{Verifier: v})
+	require.NoError(t, err)
+
+	var p packet.Packet
+
+	require.ErrorContains(t, decoder.Decode(legacyPacket(21.5, 40, 100000, 3300), &p), "missing authentication")
+	assert.Equal(t, uint64(1), v.Rejected())
+}
+
+func TestDecoderSerialLogLine(t *testing.T) {
+	decoder, err := packet.NewDecoder([]string{packet.DecoderSerialLogLine}, packet.DecoderOptions{Tag: "qf8mzr"})
+	require.NoError(t, err)
+
+	p := packet.Packet{Device: "qf8mzr"}
+	require.NoError(t, decoder.Decode([]byte("I (4041275) qf8mzr: -150,2834,99819,3300"), &p))
+	assert.InDelta(t, -1.5, p.Temperature, 1e-6)
+	assert.InDelta(t, 28.34, p.Humidity, 1e-6)
+	assert.InDelta(t, 3300, p.Voltage, 1e-6)
+
+	err = decoder.Decode([]byte("I (378) heap_init: At 3FFAE6E0 len 00001920 (6 KiB): DRAM"), &p)
+	require.ErrorIs(t, err, packet.ErrUnrecognized)
+}
+
+func TestRegisterDecoder(t *testing.T) {
+	custom := func(packet.DecoderOptions) packet.Decoder {
+		return packet.DecoderFunc(func(data []byte, p *packet.Packet) error {
+			p.Temperature = float32(len(data))
+
+			return nil
+		})
+	}
+
+	require.NoError(t, packet.RegisterDecoder("test-length", custom))
+	require.Error(t, packet.RegisterDecoder("test-length", custom))
+	require.Error(t, packet.RegisterDecoder(packet.DecoderUDPFrame, custom))
+	assert.Contains(t, packet.Decoders(), "test-length")
+
+	decoder, err := packet.NewDecoder([]string{"test-length"}, packet.DecoderOptions{})
+	require.NoError(t, err)
+
+	var p packet.Packet
+
+	require.NoError(t, decoder.Decode([]byte("abc"), &p))
+	assert.InDelta(t, 3, p.Temperature, 1e-6)
+
+	_, err = packet.NewDecoder([]string{"unknown"}, packet.DecoderOptions{})
+	require.ErrorContains(t, err, "unknown decoder: unknown")
+
+	_, err = packet.NewDecoder(nil, packet.DecoderOptions{})
+	require.Error(t, err)
+}
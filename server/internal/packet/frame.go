@@ -0,0 +1,119 @@
+package packet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// A UDP frame is laid out as, multi-byte fields little-endian:
+//
+//	magic     2 bytes  "TS"
+//	version   1 byte   FrameVersion
+//	id length 1 byte   1..MaxDeviceIDSize
+//	device id n bytes
+//	sequence  4 bytes  incremented by the sensor for every reading
+//	payload   9 bytes  same as the ESP-NOW payload
+//	crc       2 bytes  CRC16 of everything before it
+//	epoch     4 bytes  optional, boots of the sensor
+//	tag       8 bytes  with the epoch, see Tag, of everything before it
+//
+// The epoch and sequence are the Counter of authenticated frames.
+const (
+	FrameVersion    = 1
+	MaxDeviceIDSize = 32
+
+	frameMagic0     = 'T'
+	frameMagic1     = 'S'
+	frameHeaderSize = 2 + 1 + 1
+	frameMinSize    = frameHeaderSize + 1 + 4 + espNowPayloadSize + 2
+
+	udpLegacyPacketSize = 16
+)
+
+var (
+	errInvalidFrameSize     = errors.New("invalid frame size")
+	errInvalidFrameMagic    = errors.New("invalid frame magic")
+	errUnsupportedVersion   = errors.New("unsupported frame version")
+	errInvalidFrameDeviceID = errors.New("invalid frame device id")
+	errInvalidFrameCRC      = errors.New("invalid frame crc")
+	errInvalidUDPPacketSize = errors.New("invalid udp packet size")
+)
+
+// IsUDPFrame reports whether data starts like a framed UDP packet.
+func IsUDPFrame(data []byte) bool {
+	return len(data) >= 2 && data[0] == frameMagic0 && data[1] == frameMagic1
+}
+
+// EncodeUDPFrame decodes a framed UDP packet, the device and sequence come
+// from the frame. With a verifier the frame must carry a valid tag, without
+// one a tag is ignored.
+func EncodeUDPFrame(data []byte, p *Packet, v *Verifier) error {
+	if len(data) < frameMinSize {
+		return fmt.Errorf("%w: got %d, want at least %d", errInvalidFrameSize, len(data), frameMinSize)
+	}
+
+	if !IsUDPFrame(data) {
+		return fmt.Errorf("%w: got 0x%02x%02x", errInvalidFrameMagic, data[0], data[1])
+	}
+
+	if data[2] != FrameVersion {
+		return fmt.Errorf("%w: %d", errUnsupportedVersion, data[2])
+	}
+
+	idSize := int(data[3])
+	if idSize == 0 || idSize > MaxDeviceIDSize {
+		return fmt.Errorf("%w: length %d", errInvalidFrameDeviceID, idSize)
+	}
+
+	frameSize := frameMinSize - 1 + idSize
+
+	var message, tag []byte
+
+	switch {
+	case len(data) == frameSize+epochSize+TagSize:
+		message, tag = data[:frameSize+epochSize], data[frameSize+epochSize:]
+		data = data[:frameSize]
+	case len(data) != frameSize:
+		return fmt.Errorf("%w: got %d, want %d", errInvalidFrameSize, len(data), frameSize)
+	}
+
+	crcOffset := len(data) - 2
+	wantCRC := binary.LittleEndian.Uint16(data[crcOffset:])
+	gotCRC := crc16LE(data[:crcOffset])
+
+	if gotCRC != wantCRC {
+		return fmt.Errorf("%w: got=0x%04x want=0x%04x", errInvalidFrameCRC, gotCRC, wantCRC)
+	}
+
+	device := data[frameHeaderSize : frameHeaderSize+idSize]
+	for _, c := range device {
+		if c <= ' ' || c > '~' {
+			return fmt.Errorf("%w: %q", errInvalidFrameDeviceID, device)
+		}
+	}
+
+	sequenceOffset := frameHeaderSize + idSize
+	sequence := binary.LittleEndian.Uint32(data[sequenceOffset:])
+
+	if v != nil && tag == nil {
+		return v.Reject()
+	}
+
+	if err := parseMQTTPayload(data[sequenceOffset+4:crcOffset], p); err != nil {
+		return err
+	}
+
+	if v != nil {
+		counter := Counter{Epoch: binary.LittleEndian.Uint32(message[frameSize:]), Count: sequence}
+
+		if err := v.authenticate(string(device), counter, message, tag, p); err != nil {
+			return err
+		}
+	}
+
+	p.Device = string(device)
+	p.Sequence = sequence
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package packet_test
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"temperature-sensor/internal/packet"
+)
+
+func testFrame(device string, sequence uint32) []byte {
+	var (
+		temperature = int16(-1234)
+		pressurePa  = uint32(101325)
+	)
+
+	data := []byte{'T', 'S', packet.FrameVersion, byte(len(device))}
+	data = append(data, device...)
+	data = binary.LittleEndian.AppendUint32(data, sequence)
+	data = binary.LittleEndian.AppendUint16(data, uint16(temperature))
+	data = binary.LittleEndian.AppendUint16(data, 5678)
+	data = append(data, byte(pressurePa>>16), byte(pressurePa>>8), byte(pressurePa))
+	data = binary.LittleEndian.AppendUint16(data, 3300)
+
+	return binary.LittleEndian.AppendUint16(data, crc16LEForTest(data))
+}
+
+func TestEncodeUDPFrame(t *testing.T) {
+	data := testFrame("balcony", 42)
+	require.True(t, packet.IsUDPFrame(data))
+
+	var pack packet.Packet
+
+	err := packet.EncodeUDPFrame(data, &pack, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "balcony", pack.Device)
+	assert.Equal(t, uint32(42), pack.Sequence)
+	assert.InEpsilon(t, -12.34, pack.Temperature, 1e-6)
+	assert.InEpsilon(t, 56.78, pack.Humidity, 1e-6)
+	assert.InEpsilon(t, float32(101325.0/133.322), pack.Pressure, 1e-6)
+	assert.InEpsilon(t, 3300.0, pack.Voltage, 1e-6)
+	assert.False(t, pack.Timestamp.IsZero())
+}
+
+func TestEncodeUDPFrameErrors(t *testing.T) {
+	tests := map[string]struct {
+		data func() []byte
+		err  string
+	}{
+		"short": {
+			data: func() []byte { return testFrame("a", 1)[:10] },
+			err:  "invalid frame size",
+		},
+		"truncated": {
+			data: func() []byte { return testFrame("balcony", 1)[:20] },
+			err:  "invalid frame size",
+		},
+		"version": {
+			data: func() []byte {
+				data := testFrame("balcony", 1)
+				data[2] = 2
+
+				return data
+			},
+			err: "unsupported frame version",
+		},
+		"crc": {
+			data: func() []byte {
+				data := testFrame("balcony", 1)
+				data[len(data)-3] ^= 0xff
+
+				return data
+			},
+			err: "invalid frame crc",
+		},
+		"empty device": {
+			data: func() []byte { return testFrame("", 1) },
+			err:  "invalid frame size",
+		},
+		"binary device": {
+			data: func() []byte { return testFrame("a\x00b", 1) },
+			err:  "invalid frame device id",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var pack packet.Packet
+
+			err := packet.EncodeUDPFrame(tt.data(), &pack, nil)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+}
+
+func TestEncodeUDPPacketRejectsOtherSizes(t *testing.T) {
+	var pack packet.Packet
+
+	err := packet.EncodeUDPPacket(make([]byte, 20), &pack)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid udp packet size")
+}
@@ -0,0 +1,256 @@
+package packet
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Metrics a JSON field can be mapped to.
+const (
+	FieldTemperature = "temperature"
+	FieldHumidity    = "humidity"
+	FieldPressure    = "pressure"
+	FieldVoltage     = "voltage"
+)
+
+const pascalPerHPa = 100
+
+var (
+	errInvalidJSONField = errors.New("invalid json field, want metric=path[:unit]")
+	errUnknownMetric    = errors.New("unknown metric")
+	errUnknownUnit      = errors.New("unknown unit")
+	errNoJSONValues     = errors.New("no mapped field found")
+	errInvalidJSONValue = errors.New("invalid json value")
+)
+
+type unitConverter func(v float64) float32
+
+// units converts a declared unit to the one packets carry, the first unit of
+// every metric is the default.
+//
+//nolint:gochecknoglobals
+var units = map[string][]struct {
+	name    string
+	convert unitConverter
+}{
+	FieldTemperature: {
+		{"c", func(v float64) float32 { return float32(v) }},
+		{"f", func(v float64) float32 { return float32((v - 32) * 5 / 9) }},
+	},
+	FieldHumidity: {
+		{"%", func(v float64) float32 { return float32(v) }},
+	},
+	FieldPressure: {
+		{"mmhg", func(v float64) float32 { return float32(v) }},
+		{"hpa", func(v float64) float32 { return PascalToMmHg(float32(v * pascalPerHPa)) }},
+		{"pa", func(v float64) float32 { return PascalToMmHg(float32(v)) }},
+	},
+	FieldVoltage: {
+		{"mv", func(v float64) float32 { return float32(v) }},
+		{"v", func(v float64) float32 { return float32(v * 1000) }},
+	},
+}
+
+// JSONField maps a value of a JSON object to a metric.
+type JSONField struct {
+	Metric  string
+	Path    []string
+	Unit    string
+	convert unitConverter
+}
+
+func (f JSONField) String() string {
+	return f.Metric + "=" + strings.Join(f.Path, ".") + ":" + f.Unit
+}
+
+// ParseJSONFields parses comma separated metric=path[:unit] entries. Paths
+// are dot separated object keys, matched case-insensitively, or array
+// indexes. Units:
+//   - temperature: c (default), f
+//   - humidity: %
+//   - pressure: mmhg (default), hpa, pa
+//   - voltage: mv (default), v
+func ParseJSONFields(s string) ([]JSONField, error) {
+	fields := make([]JSONField, 0, strings.Count(s, ",")+1)
+
+	for entry := range strings.SplitSeq(s, ",") {
+		entry = strings.TrimSpace(entry)
+
+		metric, rest, ok := strings.Cut(entry, "=")
+		if !ok || metric == "" || rest == "" {
+			return nil, fmt.Errorf("%w: %q", errInvalidJSONField, entry)
+		}
+
+		path, unit, _ := strings.Cut(rest, ":")
+
+		field, err := newJSONField(strings.ToLower(metric), path, strings.ToLower(unit))
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", entry, err)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields, nil
+}
+
+func newJSONField(metric, path, unit string) (JSONField, error) {
+	metricUnits, ok := units[metric]
+	if !ok {
+		return JSONField{}, fmt.Errorf("%w: %s", errUnknownMetric, metric)
+	}
+
+	if unit == "" {
+		unit = metricUnits[0].name
+	}
+
+	for _, u := range metricUnits {
+		if u.name == unit {
+			return JSONField{
+				Metric:  metric,
+				Path:    strings.Split(path, "."),
+				Unit:    unit,
+				convert: u.convert,
+			}, nil
+		}
+	}
+
+	return JSONField{}, fmt.Errorf("%w: %s for %s", errUnknownUnit, unit, metric)
+}
+
+// EncodeJSON decodes a JSON object, metrics missing from it are listed in
+// p.Missing but at least one has to be present.
+func EncodeJSON(data []byte, fields []JSONField, p *Packet) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	var object any
+	if err := decoder.Decode(&object); err != nil {
+		return fmt.Errorf("decode json: %w", err)
+	}
+
+	found := make(map[string]bool, len(fields))
+
+	for _, field := range fields {
+		value, ok := lookupPath(object, field.Path)
+		if !ok || value == nil {
+			continue
+		}
+
+		v, err := jsonFloat(value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", strings.Join(field.Path, "."), err)
+		}
+
+		setField(p, field.Metric, field.convert(v))
+		found[field.Metric] = true
+	}
+
+	if len(found) == 0 {
+		return errNoJSONValues
+	}
+
+	p.Missing = nil
+
+	for _, metric := range []string{FieldTemperature, FieldHumidity, FieldPressure, FieldVoltage} {
+		if !found[metric] {
+			p.Missing = append(p.Missing, metric)
+		}
+	}
+
+	p.Timestamp = time.Now()
+
+	return nil
+}
+
+func lookupPath(value any, path []string) (any, bool) {
+	for _, key := range path {
+		switch v := value.(type) {
+		case map[string]any:
+			next, ok := v[key]
+			if !ok {
+				next, ok = lookupFold(v, key)
+			}
+
+			if !ok {
+				return nil, false
+			}
+
+			value = next
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+
+			value = v[i]
+		default:
+			return nil, false
+		}
+	}
+
+	return value, true
+}
+
+func lookupFold(object map[string]any, key string) (any, bool) {
+	for k, v := range object {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
+
+func jsonFloat(value any) (float64, error) {
+	var s string
+
+	switch v := value.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = strings.TrimSpace(v)
+	default:
+		return 0, fmt.Errorf("%w: %v", errInvalidJSONValue, value)
+	}
+
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", errInvalidJSONValue, s)
+	}
+
+	return f, nil
+}
+
+func setField(p *Packet, metric string, v float32) {
+	switch metric {
+	case FieldTemperature:
+		p.Temperature = v
+	case FieldHumidity:
+		p.Humidity = v
+	case FieldPressure:
+		p.Pressure = v
+	case FieldVoltage:
+		p.Voltage = v
+	}
+}
+
+func newJSONDecoder(opts DecoderOptions) Decoder {
+	return DecoderFunc(func(data []byte, p *Packet) error {
+		if trimmed := bytes.TrimSpace(data); len(trimmed) == 0 || trimmed[0] != '{' {
+			return fmt.Errorf("%w: not a json object", ErrUnrecognized)
+		}
+
+		// JSON payloads cannot carry a tag
+		if opts.Verifier != nil {
+			return opts.Verifier.Reject()
+		}
+
+		return EncodeJSON(data, opts.JSONFields, p)
+	})
+}
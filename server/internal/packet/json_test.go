@@ -0,0 +1,94 @@
+package packet_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"temperature-sensor/internal/packet"
+)
+
+func TestParseJSONFields(t *testing.T) {
+	fields, err := packet.ParseJSONFields("temperature=BME280.Temperature:F, pressure=pressure:hpa,humidity=hum")
+	require.NoError(t, err)
+	require.Len(t, fields, 3)
+	assert.Equal(t, "temperature=BME280.Temperature:f", fields[0].String())
+	assert.Equal(t, "humidity=hum:%", fields[2].String())
+
+	tests := map[string]string{
+		"temperature":          "invalid json field",
+		"=temperature":         "invalid json field",
+		"wind=speed":           "unknown metric",
+		"pressure=pressure:kg": "unknown unit",
+		"voltage=battery:%":    "unknown unit",
+	}
+
+	for input, expected := range tests {
+		_, err := packet.ParseJSONFields(input)
+		require.ErrorContains(t, err, expected, "input: %q", input)
+	}
+}
+
+func TestDecoderJSON(t *testing.T) {
+	tests := map[string]struct {
+		fields   string
+		payload  string
+		expected packet.Packet
+	}{
+		"zigbee2mqtt": {
+			fields:   "temperature=temperature,humidity=humidity,pressure=pressure:hpa,voltage=voltage:mv",
+			payload:  `{"battery":100,"humidity":40,"linkquality":120,"pressure":1013.25,"temperature":21.3,"voltage":2900}`,
+			expected: packet.Packet{Temperature: 21.3, Humidity: 40, Pressure: 760, Voltage: 2900},
+		},
+		"tasmota": {
+			fields:   "temperature=BME280.Temperature:f,humidity=bme280.humidity,pressure=BME280.Pressure:pa",
+			payload:  `{"Time":"2024-01-01T10:00:00","BME280":{"Temperature":70.7,"Humidity":"41.5","Pressure":99991.9}}`,
+			expected: packet.Packet{Temperature: 21.5, Humidity: 41.5, Pressure: 750, Missing: []string{packet.FieldVoltage}},
+		},
+		"array and volts": {
+			fields:  "temperature=sensors.1.t,voltage=battery:v",
+			payload: `{"sensors":[{"t":5},{"t":-3.5}],"battery":3.3}`,
+			expected: packet.Packet{
+				Temperature: -3.5, Voltage: 3300, Missing: []string{packet.FieldHumidity, packet.FieldPressure},
+			},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			fields, err := packet.ParseJSONFields(tt.fields)
+			require.NoError(t, err)
+
+			decoder, err := packet.NewDecoder([]string{packet.DecoderJSON}, packet.DecoderOptions{JSONFields: fields})
+			require.NoError(t, err)
+
+			p := packet.Packet{Device: "kitchen"}
+			require.NoError(t, decoder.Decode([]byte(tt.payload), &p))
+
+			assert.Equal(t, "kitchen", p.Device)
+			assert.False(t, p.Timestamp.IsZero())
+			assert.InDelta(t, tt.expected.Temperature, p.Temperature, 0.01)
+			assert.InDelta(t, tt.expected.Humidity, p.Humidity, 0.01)
+			assert.InDelta(t, tt.expected.Pressure, p.Pressure, 0.01)
+			assert.InDelta(t, tt.expected.Voltage, p.Voltage, 0.01)
+			assert.Equal(t, tt.expected.Missing, p.Missing)
+		})
+	}
+}
+
+func TestDecoderJSONErrors(t *testing.T) {
+	fields, err := packet.ParseJSONFields("temperature=temperature")
+	require.NoError(t, err)
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderESPNowFrame, packet.DecoderJSON},
+		packet.DecoderOptions{JSONFields: fields})
+	require.NoError(t, err)
+
+	var p packet.Packet
+
+	require.ErrorIs(t, decoder.Decode([]byte("online"), &p), packet.ErrUnrecognized)
+	require.ErrorContains(t, decoder.Decode([]byte(`{"state":"ON"}`), &p), "no mapped field found")
+	require.ErrorContains(t, decoder.Decode([]byte(`{"temperature":"warm"}`), &p), "invalid json value")
+	require.ErrorContains(t, decoder.Decode([]byte(`{"temperature":`), &p), "decode json")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 )
@@ -46,16 +47,33 @@ func (sp *SafePacket) Get() Packet {
 }
 
 type Packet struct {
+	Device      string    `json:"device"`
 	Timestamp   time.Time `json:"timestamp"`
 	Temperature float32   `json:"temperature"`
 	Humidity    float32   `json:"humidity"`
 	Pressure    float32   `json:"pressure"`
 	Voltage     float32   `json:"voltage"`
+	// Sequence is counted by sensors that send framed packets, zero otherwise.
+	Sequence uint32 `json:"sequence,omitempty"`
+	// RSSI in dBm of the radio link, zero when the receiver does not tell.
+	RSSI int `json:"rssi,omitempty"`
+	// Missing lists the metrics (Field constants) the source did not send.
+	// Their values are zero and must not be recorded.
+	Missing []string `json:"missing,omitempty"`
+	// Retransmit is set on authenticated packets repeating the last counter,
+	// they count for the link quality but are never stored.
+	Retransmit bool `json:"-"`
+}
+
+// Has reports whether the packet carries a value of metric.
+func (p Packet) Has(metric string) bool {
+	return !slices.Contains(p.Missing, metric)
 }
 
 func (p Packet) String() string {
 	return fmt.Sprintf(
-		"Packet{timestamp=%s temperature=%.2f humidity=%.2f pressure=%.2f voltage=%.0f}",
+		"Packet{device=%s timestamp=%s temperature=%.2f humidity=%.2f pressure=%.2f voltage=%.0f}",
+		p.Device,
 		p.Timestamp.Format(time.RFC3339Nano),
 		p.Temperature,
 		p.Humidity,
@@ -68,7 +86,16 @@ func PascalToMmHg(pascal float32) float32 {
 	return pascal / 133.322
 }
 
+func MmHgToPascal(mmHg float32) float32 {
+	return mmHg * 133.322
+}
+
+// EncodeUDPPacket decodes the legacy UDP packet of four float32 values.
 func EncodeUDPPacket(data []byte, p *Packet) error {
+	if len(data) != udpLegacyPacketSize {
+		return fmt.Errorf("%w: got %d, want %d", errInvalidUDPPacketSize, len(data), udpLegacyPacketSize)
+	}
+
 	buf := bytes.NewReader(data)
 
 	err := binary.Read(buf, binary.LittleEndian, &p.Temperature)
@@ -97,7 +124,41 @@ func EncodeUDPPacket(data []byte, p *Packet) error {
 	return nil
 }
 
-func EncodeMQTTPacket(data []byte, p *Packet) error {
+// EncodeMQTTPacket decodes an ESP-NOW frame. With a verifier the frame must
+// be followed by a uint32 counter, a uint32 epoch and the tag of all three
+// made with the key of p.Device, the counter becomes the sequence.
+func EncodeMQTTPacket(data []byte, p *Packet, v *Verifier) error {
+	if v == nil {
+		return decodeESPNowFrame(data, p)
+	}
+
+	const signedSize = espNowPacketSize + 4 + epochSize
+
+	if len(data) != signedSize+TagSize {
+		return v.Reject()
+	}
+
+	message, tag := data[:signedSize], data[signedSize:]
+
+	if err := decodeESPNowFrame(message[:espNowPacketSize], p); err != nil {
+		return err
+	}
+
+	counter := Counter{
+		Epoch: binary.LittleEndian.Uint32(message[espNowPacketSize+4:]),
+		Count: binary.LittleEndian.Uint32(message[espNowPacketSize:]),
+	}
+
+	if err := v.authenticate(p.Device, counter, message, tag, p); err != nil {
+		return err
+	}
+
+	p.Sequence = counter.Count
+
+	return nil
+}
+
+func decodeESPNowFrame(data []byte, p *Packet) error {
 	payload, err := mqttPayload(data)
 	if err != nil {
 		return err
@@ -60,7 +60,7 @@ func TestEncodeMQTTPacket(t *testing.T) {
 
 	var pack packet.Packet
 
-	err := packet.EncodeMQTTPacket(data, &pack)
+	err := packet.EncodeMQTTPacket(data, &pack, nil)
 	require.NoError(t, err)
 
 	assert.InEpsilon(t, 23.45, pack.Temperature, 1e-6)
@@ -77,7 +77,7 @@ func TestEncodeMQTTPacketInvalidCRC(t *testing.T) {
 
 	var pack packet.Packet
 
-	err := packet.EncodeMQTTPacket(data, &pack)
+	err := packet.EncodeMQTTPacket(data, &pack, nil)
 	require.Error(t, err)
 	assert.Contains(t, err.Error(), "invalid crc")
 }
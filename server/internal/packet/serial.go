@@ -0,0 +1,188 @@
+package packet
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	serialFieldMAC  = "mac"
+	serialFieldRSSI = "rssi"
+)
+
+var errInvalidSerialField = errors.New("invalid serial field")
+
+func parseInt(s string, i *int) (int, bool) {
+	n := len(s)
+	start := *i
+	sign := 1
+	val := 0
+
+	if *i < n && s[*i] == '-' {
+		sign = -1
+		*i++
+	}
+
+	for *i < n {
+		c := s[*i]
+		if c < '0' || c > '9' {
+			break
+		}
+
+		val = val*10 + int(c-'0')
+		*i++
+	}
+
+	if *i == start || (*i == start+1 && sign == -1) {
+		return 0, false
+	}
+
+	return val * sign, true
+}
+
+type payload struct {
+	temperature int
+	humidity    int
+	pressure    int
+	voltage     int
+	// extra follows the values, the extended format has key=value fields
+	// there.
+	extra string
+}
+
+func parseFast(line string, tag string, out *payload) bool { //nolint:cyclop
+	// 1. быстрый фильтр по TAG
+	tagPos := strings.Index(line, tag)
+	if tagPos == -1 {
+		return false
+	}
+
+	// 2. ищем ':' после TAG
+	colon := strings.IndexByte(line[tagPos+len(tag):], ':')
+	if colon == -1 {
+		return false
+	}
+
+	colon += tagPos + len(tag) + 1 // абсолютная позиция
+
+	// 3. указатель на payload
+	s := line[colon:]
+	n := len(s)
+	i := 0
+
+	// пропускаем пробелы
+	for i < n && s[i] == ' ' {
+		i++
+	}
+
+	var ok bool
+
+	// parse int1
+	out.temperature, ok = parseInt(s, &i)
+	if !ok || i >= n || s[i] != ',' {
+		return false
+	}
+
+	i++
+
+	// parse int2
+	out.humidity, ok = parseInt(s, &i)
+	if !ok || i >= n || s[i] != ',' {
+		return false
+	}
+
+	i++
+
+	// parse int3
+	out.pressure, ok = parseInt(s, &i)
+	if !ok || i >= n || s[i] != ',' {
+		return false
+	}
+
+	i++
+
+	// parse int4
+	out.voltage, ok = parseInt(s, &i)
+	out.extra = s[i:]
+
+	return ok
+}
+
+// extras are the optional fields of the extended format.
+type extras struct {
+	mac  string
+	rssi int
+}
+
+// parseExtras reads the key=value fields after the values, unknown keys and
+// other words are skipped. Colored logs end with an escape sequence.
+func parseExtras(s string) (extras, error) {
+	var out extras
+
+	s, _, _ = strings.Cut(s, "\x1b")
+
+	for _, field := range strings.Fields(s) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case serialFieldMAC:
+			mac, err := net.ParseMAC(value)
+			if err != nil {
+				return extras{}, fmt.Errorf("%w: %w", errInvalidSerialField, err)
+			}
+
+			out.mac = strings.ToUpper(mac.String())
+		case serialFieldRSSI:
+			rssi, err := strconv.Atoi(value)
+			if err != nil {
+				return extras{}, fmt.Errorf("%w: rssi=%q", errInvalidSerialField, value)
+			}
+
+			out.rssi = rssi
+		}
+	}
+
+	return out, nil
+}
+
+// EncodeSerialLine decodes a receiver log line like "I (4041275) tag: 2314,2834,99819,3300",
+// lines without the tag are not readings. The extended format appends the
+// sender as "mac=AA:BB:CC:DD:EE:FF rssi=-67", the MAC, or its name in names,
+// then becomes the device.
+func EncodeSerialLine(line, tag string, names map[string]string, p *Packet) error {
+	var pl payload
+
+	if !parseFast(line, tag, &pl) {
+		return fmt.Errorf("%w: no %q reading", ErrUnrecognized, tag)
+	}
+
+	ext, err := parseExtras(pl.extra)
+	if err != nil {
+		return err
+	}
+
+	if ext.mac != "" {
+		p.Device = ext.mac
+
+		if name, ok := names[ext.mac]; ok {
+			p.Device = name
+		}
+	}
+
+	p.RSSI = ext.rssi
+
+	p.Temperature = float32(pl.temperature) / 100.0
+	p.Humidity = float32(pl.humidity) / 100.0
+	p.Pressure = PascalToMmHg(float32(pl.pressure))
+	p.Voltage = float32(pl.voltage)
+	p.Timestamp = time.Now()
+
+	return nil
+}
@@ -0,0 +1,74 @@
+package packet //nolint:testpackage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseString(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+		payload  payload
+	}{
+		{"I (4041275) qf8mzr: 2314,2834,99819,32", true,
+			payload{temperature: 2314, humidity: 2834, pressure: 99819, voltage: 32}},
+		{"I (378) heap_init: At 3FFAE6E0 len 00001920 (6 KiB): DRAM", false, payload{}},
+		{"I (4041275) qf8mzr: 2314,2834", false, payload{}},
+		{"I (4041275) qf8mzr: 2314,2834,99819,123", true,
+			payload{temperature: 2314, humidity: 2834, pressure: 99819, voltage: 123}},
+		{"I (4041275) qf8mzr: -1,2834,99819,123", true,
+			payload{temperature: -1, humidity: 2834, pressure: 99819, voltage: 123}},
+		{"I (4041275) qf8mzr: abc,2834,99819", false, payload{}},
+		{"Random string without tag", false, payload{}},
+	}
+
+	tag := "qf8mzr"
+
+	for _, test := range tests {
+		var out payload
+
+		result := parseFast(test.input, tag, &out)
+
+		require.Equal(t, test.expected, result, "input: %q", test.input)
+
+		if test.expected {
+			assert.Equal(t, test.payload, out, "input: %q", test.input)
+		}
+	}
+}
+
+func TestEncodeSerialLineExtended(t *testing.T) {
+	names := map[string]string{"24:0A:C4:12:34:56": "balcony"}
+
+	tests := []struct {
+		line   string
+		device string
+		rssi   int
+	}{
+		{"I (4041275) qf8mzr: 2314,2834,99819,3300", "qf8mzr", 0},
+		{"I (4041275) qf8mzr: 2314,2834,99819,3300 mac=24:0a:c4:12:34:56 rssi=-67", "balcony", -67},
+		{"I (4041275) qf8mzr: 2314,2834,99819,3300 rssi=-80 mac=24:0a:c4:ab:cd:ef", "24:0A:C4:AB:CD:EF", -80},
+		{"\x1b[0;32mI (4041275) qf8mzr: 2314,2834,99819,3300 mac=24:0a:c4:12:34:56 rssi=-67\x1b[0m", "balcony", -67},
+		{"I (4041275) qf8mzr: 2314,2834,99819,3300 ch=1 mac=24:0a:c4:12:34:56", "balcony", 0},
+	}
+
+	for _, test := range tests {
+		p := Packet{Device: "qf8mzr"}
+
+		require.NoError(t, EncodeSerialLine(test.line, "qf8mzr", names, &p), test.line)
+		assert.Equal(t, test.device, p.Device, test.line)
+		assert.Equal(t, test.rssi, p.RSSI, test.line)
+		assert.InDelta(t, 23.14, p.Temperature, 1e-6, test.line)
+	}
+
+	p := Packet{}
+	err := EncodeSerialLine("I (1) qf8mzr: 2314,2834,99819,3300 mac=nope", "qf8mzr", names, &p)
+	require.ErrorIs(t, err, errInvalidSerialField)
+	require.NotErrorIs(t, err, ErrUnrecognized)
+
+	err = EncodeSerialLine("I (1) qf8mzr: 2314,2834,99819,3300 rssi=strong", "qf8mzr", names, &p)
+	require.ErrorIs(t, err, errInvalidSerialField)
+}
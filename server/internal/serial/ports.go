@@ -0,0 +1,82 @@
+package serial
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.bug.st/serial/enumerator"
+)
+
+const usbPrefix = "usb:"
+
+var errInvalidPattern = errors.New("invalid serial port, want a path, a glob or usb:VID[:PID]")
+
+// portPattern selects serial ports by path, glob or USB ids.
+type portPattern struct {
+	path string
+	vid  string
+	pid  string
+}
+
+func parsePattern(s string) (portPattern, error) {
+	ids, ok := strings.CutPrefix(s, usbPrefix)
+	if !ok {
+		if _, err := filepath.Match(s, ""); err != nil {
+			return portPattern{}, fmt.Errorf("%w: %q: %w", errInvalidPattern, s, err)
+		}
+
+		return portPattern{path: s}, nil
+	}
+
+	vid, pid, _ := strings.Cut(ids, ":")
+	if !isUSBID(vid) || (pid != "" && !isUSBID(pid)) {
+		return portPattern{}, fmt.Errorf("%w: %q", errInvalidPattern, s)
+	}
+
+	return portPattern{vid: strings.ToLower(vid), pid: strings.ToLower(pid)}, nil
+}
+
+// isUSBID reports whether s is a 4 digit hex id.
+func isUSBID(s string) bool {
+	_, err := strconv.ParseUint(s, 16, 16)
+
+	return len(s) == 4 && err == nil
+}
+
+func (p portPattern) match(port *enumerator.PortDetails) bool {
+	if p.path != "" {
+		ok, _ := filepath.Match(p.path, port.Name)
+
+		return ok
+	}
+
+	return port.IsUSB && strings.EqualFold(port.VID, p.vid) && (p.pid == "" || strings.EqualFold(port.PID, p.pid))
+}
+
+// resolve returns the present ports matching any pattern. Paths and globs
+// are also looked up in the file system, the enumerator misses ports such
+// as pseudo terminals.
+func resolve(patterns []portPattern, ports []*enumerator.PortDetails, glob func(string) ([]string, error)) []string {
+	var names []string
+
+	for _, pattern := range patterns {
+		for _, port := range ports {
+			if pattern.match(port) {
+				names = append(names, port.Name)
+			}
+		}
+
+		if pattern.path != "" {
+			matches, _ := glob(pattern.path)
+			names = append(names, matches...)
+		}
+	}
+
+	slices.Sort(names)
+
+	return slices.Compact(names)
+}
@@ -0,0 +1,63 @@
+package serial //nolint:testpackage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.bug.st/serial/enumerator"
+)
+
+func TestParsePattern(t *testing.T) {
+	pattern, err := parsePattern("usb:303A:1001")
+	require.NoError(t, err)
+	assert.Equal(t, portPattern{vid: "303a", pid: "1001"}, pattern)
+
+	pattern, err = parsePattern("usb:10c4")
+	require.NoError(t, err)
+	assert.Equal(t, portPattern{vid: "10c4"}, pattern)
+
+	pattern, err = parsePattern("/dev/ttyACM*")
+	require.NoError(t, err)
+	assert.Equal(t, portPattern{path: "/dev/ttyACM*"}, pattern)
+
+	for _, s := range []string{"usb:", "usb:303a:10", "usb:xyzw", "/dev/tty[ACM"} {
+		_, err := parsePattern(s)
+		require.ErrorIs(t, err, errInvalidPattern, s)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	ports := []*enumerator.PortDetails{
+		{Name: "/dev/ttyACM1", IsUSB: true, VID: "303A", PID: "1001"},
+		{Name: "/dev/ttyUSB0", IsUSB: true, VID: "10C4", PID: "EA60"},
+		{Name: "/dev/ttyS0"},
+	}
+
+	files := map[string][]string{
+		"/dev/ttyACM*": {"/dev/ttyACM1"},
+		"/dev/pts/3":   {"/dev/pts/3"},
+	}
+
+	glob := func(pattern string) ([]string, error) {
+		return files[pattern], nil
+	}
+
+	patterns := func(s ...string) []portPattern {
+		out := make([]portPattern, 0, len(s))
+
+		for _, p := range s {
+			pattern, err := parsePattern(p)
+			require.NoError(t, err)
+
+			out = append(out, pattern)
+		}
+
+		return out
+	}
+
+	assert.Equal(t, []string{"/dev/ttyACM1"}, resolve(patterns("/dev/ttyACM*", "usb:303a:1001"), ports, glob))
+	assert.Equal(t, []string{"/dev/ttyUSB0"}, resolve(patterns("usb:10c4"), ports, glob))
+	assert.Equal(t, []string{"/dev/pts/3", "/dev/ttyS0"}, resolve(patterns("/dev/pts/3", "/dev/ttyS*"), ports, glob))
+	assert.Empty(t, resolve(patterns("/dev/ttyACM0", "usb:1a86"), ports, glob))
+}
@@ -0,0 +1,105 @@
+//go:build linux
+
+package serial //nolint:testpackage
+
+import (
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+	"unsafe"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// openPTY returns the master of a pseudo-terminal pair and the path of its
+// slave, which the service opens as a serial port.
+func openPTY(t *testing.T) (*os.File, string) {
+	t.Helper()
+
+	master, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skipf("no pseudo-terminals: %v", err)
+	}
+
+	t.Cleanup(func() { master.Close() })
+
+	var unlock int32
+	ioctl(t, master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock))
+
+	var n uint32
+	ioctl(t, master, syscall.TIOCGPTN, unsafe.Pointer(&n))
+
+	return master, "/dev/pts/" + strconv.Itoa(int(n))
+}
+
+func ioctl(t *testing.T, f *os.File, req uintptr, arg unsafe.Pointer) {
+	t.Helper()
+
+	conn, err := f.SyscallConn()
+	require.NoError(t, err)
+
+	var errno syscall.Errno
+
+	require.NoError(t, conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	}))
+
+	if errno != 0 {
+		t.Skipf("pseudo-terminal ioctl: %v", errno)
+	}
+}
+
+func TestRunShutdownPTY(t *testing.T) {
+	master, slave := openPTY(t)
+
+	decoder, err := packet.NewDecoder([]string{packet.DecoderSerialLogLine}, packet.DecoderOptions{Tag: "qf8mzr"})
+	require.NoError(t, err)
+
+	srv, err := New(config.Serial{
+		Ports:        []string{slave},
+		ScanInterval: 10 * time.Millisecond,
+		RetryMin:     10 * time.Millisecond,
+		RetryMax:     10 * time.Millisecond,
+		BaudRate:     115200,
+	}, decoder, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	emitted := make(chanEmitter, 4)
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Run(ctx, "qf8mzr", emitted) }()
+
+	require.Eventually(t, func() bool { return len(srv.Ports()) == 1 }, 5*time.Second, time.Millisecond)
+
+	_, err = io.WriteString(master, "I (4041275) qf8mzr: 2314,2834,99819,3300\r\n")
+	require.NoError(t, err)
+
+	select {
+	case p := <-emitted:
+		assert.InDelta(t, 23.14, p.Temperature, 1e-6)
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reading from the pseudo-terminal")
+	}
+
+	// the port stays open without data, shutdown must not wait for a line
+	start := time.Now()
+
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+		assert.Less(t, time.Since(start), 2*readTimeout+100*time.Millisecond)
+	case <-time.After(2 * time.Second):
+		t.Fatal("serial service did not stop")
+	}
+}
@@ -3,189 +3,274 @@ package serial
 import (
 	"bufio"
 	"context"
+	"errors"
+	"io"
 	"log/slog"
-	"strings"
-	"temperature-sensor/internal/packet"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 
+	"temperature-sensor/internal/backoff"
+	"temperature-sensor/internal/capture"
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
 	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
 )
 
-const retryInterval = 2 * time.Second
+// readTimeout bounds how long a read blocks, and so shutdown.
+const readTimeout = 200 * time.Millisecond
 
+// Service reads every serial port matching its patterns, ports are
+// attached when they appear and detached when they go away.
 type Service struct {
-	portName string
+	patterns []portPattern
 	baudRate int
+	interval time.Duration
+	decoder  packet.Decoder
+	recorder *capture.Writer
+
+	// list and glob find ports, replaced in tests.
+	list func() ([]*enumerator.PortDetails, error)
+	glob func(pattern string) ([]string, error)
+	open func(name string, mode *serial.Mode) (serial.Port, error)
+
+	retryMin time.Duration
+	retryMax time.Duration
+
+	mu    sync.Mutex
+	ports map[string]*portState
 }
 
-func New(portName string, baudRate int) *Service {
-	return &Service{
-		portName: portName,
-		baudRate: baudRate,
-	}
+// portState tracks a port across scans, a port that failed is attached
+// again after a backoff delay.
+type portState struct {
+	attached bool
+	retry    *backoff.Backoff
+	next     time.Time
 }
 
-func (s *Service) Run(ctx context.Context, tag string, emitter eventEmitter) error {
-	mode := &serial.Mode{
-		BaudRate: s.baudRate,
-	}
+// New configures the service, lines read are recorded to recorder when it is
+// not nil.
+func New(cfg config.Serial, decoder packet.Decoder, recorder *capture.Writer) (*Service, error) {
+	patterns := make([]portPattern, 0, len(cfg.Ports))
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+	for _, port := range cfg.Ports {
+		pattern, err := parsePattern(port)
+		if err != nil {
+			return nil, err
 		}
 
-		port, err := serial.Open(s.portName, mode)
-		if err != nil {
-			slog.ErrorContext(ctx, "open failed", "port", s.portName, "err", err)
-			time.Sleep(retryInterval)
+		patterns = append(patterns, pattern)
+	}
 
-			continue
-		}
+	return &Service{
+		patterns: patterns,
+		baudRate: cfg.BaudRate,
+		interval: cfg.ScanInterval,
+		decoder:  decoder,
+		recorder: recorder,
+		list:     enumerator.GetDetailedPortsList,
+		glob:     filepath.Glob,
+		open:     serial.Open,
+		retryMin: cfg.RetryMin,
+		retryMax: cfg.RetryMax,
+		ports:    make(map[string]*portState),
+	}, nil
+}
 
-		err = read(ctx, port, tag, emitter)
+// Ports returns the attached ports.
+func (s *Service) Ports() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-		port.Close()
+	var names []string
 
-		if ctx.Err() != nil {
-			return ctx.Err()
+	for name, state := range s.ports {
+		if state.attached {
+			names = append(names, name)
 		}
-
-		slog.Warn("serial disconnected, retrying", "err", err)
-		time.Sleep(retryInterval)
 	}
-}
 
-type eventEmitter interface {
-	Emit(pack packet.Packet)
+	slices.Sort(names)
+
+	return names
 }
 
-func parseInt(s string, i *int) (int, bool) {
-	n := len(s)
-	start := *i
-	sign := 1
-	val := 0
+func (s *Service) Run(ctx context.Context, tag string, emitter eventEmitter) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
 
-	if *i < n && s[*i] == '-' {
-		sign = -1
-		*i++
-	}
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	found := true
+
+	for {
+		ports := s.scan(ctx)
 
-	for *i < n {
-		c := s[*i]
-		if c < '0' || c > '9' {
-			break
+		if len(ports) == 0 && found {
+			slog.InfoContext(ctx, "waiting for a serial port")
 		}
 
-		val = val*10 + int(c-'0')
-		*i++
-	}
+		found = len(ports) > 0
 
-	if *i == start || (*i == start+1 && sign == -1) {
-		return 0, false
-	}
+		for _, name := range ports {
+			if !s.attach(name, time.Now()) {
+				continue
+			}
 
-	return val * sign, true
-}
+			wg.Go(func() {
+				failed := s.runPort(ctx, name, tag, emitter)
+				s.detach(name, failed, time.Now())
+			})
+		}
 
-type payload struct {
-	temperature int
-	humidity    int
-	pressure    int
-	voltage     int
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
 }
 
-func payloadToPacket(pl payload) packet.Packet {
-	return packet.Packet{
-		Temperature: float32(pl.temperature) / 100.0,
-		Humidity:    float32(pl.humidity) / 100.0,
-		Pressure:    packet.PascalToMmHg(float32(pl.pressure)),
-		Voltage:     float32(pl.voltage),
-		Timestamp:   time.Now(),
+// scan returns the present ports matching the patterns.
+func (s *Service) scan(ctx context.Context) []string {
+	ports, err := s.list()
+	if err != nil {
+		slog.DebugContext(ctx, "serial port enumeration failed", "error", err)
 	}
+
+	return resolve(s.patterns, ports, s.glob)
 }
 
-func parseFast(line string, tag string, out *payload) bool { //nolint:cyclop
-	// 1. быстрый фильтр по TAG
-	tagPos := strings.Index(line, tag)
-	if tagPos == -1 {
-		return false
+// attach reports whether the port is not read yet and not waiting for a
+// retry.
+func (s *Service) attach(name string, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.ports[name]
+	if !ok {
+		state = &portState{retry: backoff.New(s.retryMin, s.retryMax)}
+		s.ports[name] = state
 	}
 
-	// 2. ищем ':' после TAG
-	colon := strings.IndexByte(line[tagPos+len(tag):], ':')
-	if colon == -1 {
+	if state.attached || now.Before(state.next) {
 		return false
 	}
 
-	colon += tagPos + len(tag) + 1 // абсолютная позиция
+	state.attached = true
+
+	return true
+}
+
+// detach delays the next attach of a failed port.
+func (s *Service) detach(name string, failed bool, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// 3. указатель на payload
-	s := line[colon:]
-	n := len(s)
-	i := 0
+	state := s.ports[name]
+	state.attached = false
+	state.next = time.Time{}
 
-	// пропускаем пробелы
-	for i < n && s[i] == ' ' {
-		i++
+	if failed {
+		state.next = now.Add(state.retry.Next())
 	}
+}
 
-	var ok bool
+// opened resets the backoff of a port.
+func (s *Service) opened(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	// parse int1
-	out.temperature, ok = parseInt(s, &i)
-	if !ok || i >= n || s[i] != ',' {
-		return false
+	s.ports[name].retry.Reset()
+}
+
+// runPort reads a port until it fails or ctx is done, the next scan
+// attaches it again when it is still there.
+func (s *Service) runPort(ctx context.Context, name, tag string, emitter eventEmitter) bool {
+	port, err := s.open(name, &serial.Mode{BaudRate: s.baudRate})
+	if err != nil {
+		slog.ErrorContext(ctx, "open failed", "port", name, "err", err)
+
+		return true
 	}
+	defer port.Close()
 
-	i++
+	// a read returns within the timeout, so ctx is checked while no data comes
+	if err := port.SetReadTimeout(readTimeout); err != nil {
+		slog.ErrorContext(ctx, "set read timeout failed", "port", name, "err", err)
 
-	// parse int2
-	out.humidity, ok = parseInt(s, &i)
-	if !ok || i >= n || s[i] != ',' {
-		return false
+		return true
 	}
 
-	i++
+	s.opened(name)
+	slog.InfoContext(ctx, "serial port attached", "port", name)
 
-	// parse int3
-	out.pressure, ok = parseInt(s, &i)
-	if !ok || i >= n || s[i] != ',' {
+	err = s.read(ctx, port, name, tag, emitter)
+	if ctx.Err() != nil {
 		return false
 	}
 
-	i++
-
-	// parse int4
-	out.voltage, ok = parseInt(s, &i)
+	slog.WarnContext(ctx, "serial port detached", "port", name, "err", err)
 
-	return ok
+	return true
 }
 
-func read(ctx context.Context, port serial.Port, tag string, emitter eventEmitter) error {
-	reader := bufio.NewScanner(port)
-	reader.Split(bufio.ScanLines)
+// ctxReader reads a port with a read timeout until ctx is done, a read
+// that timed out returns no data and no error.
+type ctxReader struct {
+	ctx  context.Context //nolint:containedctx
+	port io.Reader
+}
 
-	var out payload
+func (r ctxReader) Read(b []byte) (int, error) {
+	for {
+		if err := r.ctx.Err(); err != nil {
+			return 0, err
+		}
 
-	for reader.Scan() {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
+		n, err := r.port.Read(b)
+		if n > 0 || err != nil {
+			return n, err
 		}
+	}
+}
+
+type eventEmitter interface {
+	Emit(pack packet.Packet)
+}
 
+func (s *Service) read(ctx context.Context, port serial.Port, name, tag string, emitter eventEmitter) error {
+	reader := bufio.NewScanner(ctxReader{ctx: ctx, port: port})
+	reader.Split(bufio.ScanLines)
+
+	for reader.Scan() {
 		line := reader.Text()
 		if line == "" {
 			continue
 		}
 
-		if parseFast(line, tag, &out) {
-			slog.DebugContext(ctx, "parsed payload", "line", line, "payload", out)
-			emitter.Emit(payloadToPacket(out))
+		s.recorder.Record(capture.TransportSerial, name, tag, []byte(line))
+
+		p := packet.Packet{Device: tag}
+
+		err := s.decoder.Decode([]byte(line), &p)
+		if errors.Is(err, packet.ErrUnrecognized) {
+			continue
 		}
+
+		if err != nil {
+			slog.WarnContext(ctx, "failed to decode serial line", "line", line, "error", err)
+
+			continue
+		}
+
+		slog.DebugContext(ctx, "parsed payload", "line", line, "packet", p.String())
+		emitter.Emit(p)
 	}
 
 	if err := reader.Err(); err != nil && ctx.Err() == nil {
@@ -1,41 +1,149 @@
 package serial //nolint:testpackage
 
 import (
+	"context"
+	"io"
+	"sync"
 	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.bug.st/serial"
+	"go.bug.st/serial/enumerator"
 )
 
-func TestParseString(t *testing.T) {
-	tests := []struct {
-		input    string
-		expected bool
-		payload  payload
-	}{
-		{"I (4041275) qf8mzr: 2314,2834,99819,32", true,
-			payload{temperature: 2314, humidity: 2834, pressure: 99819, voltage: 32}},
-		{"I (378) heap_init: At 3FFAE6E0 len 00001920 (6 KiB): DRAM", false, payload{}},
-		{"I (4041275) qf8mzr: 2314,2834", false, payload{}},
-		{"I (4041275) qf8mzr: 2314,2834,99819,123", true,
-			payload{temperature: 2314, humidity: 2834, pressure: 99819, voltage: 123}},
-		{"I (4041275) qf8mzr: -1,2834,99819,123", true,
-			payload{temperature: -1, humidity: 2834, pressure: 99819, voltage: 123}},
-		{"I (4041275) qf8mzr: abc,2834,99819", false, payload{}},
-		{"Random string without tag", false, payload{}},
-	}
+// pipePort is a serial port fed by a pipe.
+type pipePort struct {
+	*io.PipeReader
+}
+
+func (p pipePort) SetMode(*serial.Mode) error  { return nil }
+func (p pipePort) Write(b []byte) (int, error) { return len(b), nil }
+func (p pipePort) Drain() error                { return nil }
+func (p pipePort) ResetInputBuffer() error     { return nil }
+func (p pipePort) ResetOutputBuffer() error    { return nil }
+func (p pipePort) SetDTR(bool) error           { return nil }
+func (p pipePort) SetRTS(bool) error           { return nil }
+func (p pipePort) GetModemStatusBits() (*serial.ModemStatusBits, error) {
+	return &serial.ModemStatusBits{}, nil
+}
+func (p pipePort) SetReadTimeout(time.Duration) error { return nil }
+func (p pipePort) Break(time.Duration) error          { return nil }
+
+type chanEmitter chan packet.Packet
+
+func (e chanEmitter) Emit(p packet.Packet) {
+	e <- p
+}
 
-	tag := "qf8mzr"
+func TestRunHotPlug(t *testing.T) {
+	decoder, err := packet.NewDecoder([]string{packet.DecoderSerialLogLine}, packet.DecoderOptions{Tag: "qf8mzr"})
+	require.NoError(t, err)
 
-	for _, test := range tests {
-		var out payload
+	srv, err := New(config.Serial{
+		Ports:        []string{"usb:303a:1001"},
+		ScanInterval: 10 * time.Millisecond,
+		RetryMin:     10 * time.Millisecond,
+		RetryMax:     10 * time.Millisecond,
+	}, decoder, nil)
+	require.NoError(t, err)
 
-		result := parseFast(test.input, tag, &out)
+	var (
+		mu      sync.Mutex
+		present bool
+		writers = make(chan *io.PipeWriter, 4)
+	)
 
-		require.Equal(t, test.expected, result, "input: %q", test.input)
+	srv.list = func() ([]*enumerator.PortDetails, error) {
+		mu.Lock()
+		defer mu.Unlock()
 
-		if test.expected {
-			assert.Equal(t, test.payload, out, "input: %q", test.input)
+		if !present {
+			return nil, nil
 		}
+
+		return []*enumerator.PortDetails{{Name: "/dev/ttyACM1", IsUSB: true, VID: "303A", PID: "1001"}}, nil
+	}
+	srv.open = func(string, *serial.Mode) (serial.Port, error) {
+		r, w := io.Pipe()
+		writers <- w
+
+		return pipePort{r}, nil
 	}
+
+	emitted := make(chanEmitter, 4)
+	done := make(chan error, 1)
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	go func() { done <- srv.Run(ctx, "qf8mzr", emitted) }()
+
+	// plugged in
+	mu.Lock()
+	present = true
+	mu.Unlock()
+
+	w := <-writers
+	_, err = io.WriteString(w, "I (1) qf8mzr: 2314,2834,99819,3300\n")
+	require.NoError(t, err)
+
+	p := <-emitted
+	assert.Equal(t, "qf8mzr", p.Device)
+	assert.Equal(t, []string{"/dev/ttyACM1"}, srv.Ports())
+
+	// unplugged
+	mu.Lock()
+	present = false
+	mu.Unlock()
+
+	require.NoError(t, w.Close())
+	require.Eventually(t, func() bool { return len(srv.Ports()) == 0 }, time.Second, time.Millisecond)
+
+	// plugged in again
+	mu.Lock()
+	present = true
+	mu.Unlock()
+
+	w = <-writers
+	_, err = io.WriteString(w, "I (2) qf8mzr: 2314,2834,99819,3300\n")
+	require.NoError(t, err)
+	<-emitted
+
+	// the pipe has no read timeout, closing it ends the read
+	cancel()
+	require.NoError(t, w.Close())
+	require.NoError(t, <-done)
+}
+
+func TestAttachBackoff(t *testing.T) {
+	srv, err := New(config.Serial{RetryMin: time.Second, RetryMax: 4 * time.Second}, nil, nil)
+	require.NoError(t, err)
+
+	now := time.Now()
+	name := "/dev/ttyACM0"
+
+	require.True(t, srv.attach(name, now))
+	assert.False(t, srv.attach(name, now), "already attached")
+
+	// failures double the delay
+	srv.detach(name, true, now)
+	assert.False(t, srv.attach(name, now.Add(500*time.Millisecond)))
+	require.True(t, srv.attach(name, now.Add(time.Second)))
+
+	srv.detach(name, true, now)
+	assert.False(t, srv.attach(name, now.Add(time.Second)))
+	require.True(t, srv.attach(name, now.Add(2*time.Second)))
+
+	// a successful open starts over
+	srv.opened(name)
+	srv.detach(name, true, now)
+	assert.True(t, srv.attach(name, now.Add(time.Second)))
+
+	// shutting down is no failure
+	srv.detach(name, false, now)
+	assert.True(t, srv.attach(name, now))
 }
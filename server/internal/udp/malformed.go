@@ -0,0 +1,88 @@
+package udp
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	malformedLogInterval = 10 * time.Second
+	// maxLogDumpSize limits the hex dump in logs, the quarantine keeps it all.
+	maxLogDumpSize     = 64
+	quarantineFileMode = 0o600
+)
+
+// malformed counts and drops datagrams that do not decode. Logging is rate
+// limited so a chatty device on the LAN cannot flood the journal.
+type malformed struct {
+	count      atomic.Uint64
+	quarantine *os.File
+
+	mu         sync.Mutex
+	lastLog    time.Time
+	suppressed uint64
+}
+
+func openQuarantine(path string) (*os.File, error) {
+	if path == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, quarantineFileMode)
+	if err != nil {
+		return nil, fmt.Errorf("open quarantine: %w", err)
+	}
+
+	return file, nil
+}
+
+func (m *malformed) drop(ctx context.Context, now time.Time, addr net.Addr, data []byte, err error) {
+	total := m.count.Add(1)
+
+	if m.quarantine != nil {
+		line := fmt.Sprintf("%s\t%s\t%s\n", now.Format(time.RFC3339Nano), addr, hex.EncodeToString(data))
+		if _, writeErr := m.quarantine.WriteString(line); writeErr != nil {
+			slog.ErrorContext(ctx, "failed to quarantine UDP datagram", "error", writeErr)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastLog) < malformedLogInterval {
+		m.suppressed++
+
+		return
+	}
+
+	dump := data
+	if len(dump) > maxLogDumpSize {
+		dump = dump[:maxLogDumpSize]
+	}
+
+	slog.WarnContext(ctx, "dropped malformed UDP datagram",
+		"error", err,
+		"sender", addr.String(),
+		"size", len(data),
+		"data", hex.EncodeToString(dump),
+		"suppressed", m.suppressed,
+		"total", total)
+
+	m.lastLog = now
+	m.suppressed = 0
+}
+
+func (m *malformed) close() error {
+	if m.quarantine == nil {
+		return nil
+	}
+
+	return m.quarantine.Close() //nolint:wrapcheck
+}
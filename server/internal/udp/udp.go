@@ -8,6 +8,8 @@ import (
 	"net"
 	"time"
 
+	"temperature-sensor/internal/capture"
+	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/packet"
 )
 
@@ -17,21 +19,40 @@ const (
 )
 
 type Service struct {
-	pc net.PacketConn
+	pc        net.PacketConn
+	decoder   packet.Decoder
+	malformed *malformed
+	recorder  *capture.Writer
 }
 
-func Listen(ctx context.Context, port string) (*Service, error) {
-	slog.Info("listening UDP", "port", port)
+// Listen binds the UDP port, datagrams are recorded to recorder when it is
+// not nil.
+func Listen(
+	ctx context.Context, cfg config.UDPServer, decoder packet.Decoder, recorder *capture.Writer,
+) (*Service, error) {
+	slog.Info("listening UDP", "port", cfg.Port)
+
+	quarantine, err := openQuarantine(cfg.Quarantine)
+	if err != nil {
+		return nil, err
+	}
 
 	lc := net.ListenConfig{}
 
-	pc, err := lc.ListenPacket(ctx, "udp4", port)
+	pc, err := lc.ListenPacket(ctx, "udp4", cfg.Port)
 	if err != nil {
+		if quarantine != nil {
+			quarantine.Close()
+		}
+
 		return nil, fmt.Errorf("listenPacket: %w", err)
 	}
 
 	return &Service{
-		pc: pc,
+		pc:        pc,
+		decoder:   decoder,
+		malformed: &malformed{quarantine: quarantine},
+		recorder:  recorder,
 	}, nil
 }
 
@@ -40,7 +61,12 @@ func (s *Service) Close() error {
 		panic("init packet connection")
 	}
 
-	return s.pc.Close() //nolint:wrapcheck
+	return errors.Join(s.pc.Close(), s.malformed.close())
+}
+
+// Malformed returns how many datagrams were dropped because they did not decode.
+func (s *Service) Malformed() uint64 {
+	return s.malformed.count.Load()
 }
 
 type eventEmitter interface {
@@ -62,7 +88,7 @@ func (s *Service) Listen(ctx context.Context, emitter eventEmitter) error {
 			return fmt.Errorf("setReadDeadline: %w", err)
 		}
 
-		n, _, err := s.pc.ReadFrom(buf)
+		n, addr, err := s.pc.ReadFrom(buf)
 		if err != nil {
 			var netErr net.Error
 			if errors.As(err, &netErr) && netErr.Timeout() {
@@ -74,20 +100,45 @@ func (s *Service) Listen(ctx context.Context, emitter eventEmitter) error {
 			continue
 		}
 
-		var p packet.Packet
+		s.recorder.Record(capture.TransportUDP, addr.String(), deviceFromAddr(addr), buf[:n])
 
-		err = packet.EncodeUDPPacket(buf[:n], &p)
+		p, err := s.decode(buf[:n], addr)
 		if err != nil {
-			return fmt.Errorf("encodePacket: %w", err)
+			s.malformed.drop(ctx, time.Now(), addr, buf[:n], err)
+
+			continue
 		}
 
 		slog.InfoContext(ctx, "received packet",
+			"device", p.Device,
 			"temperature", p.Temperature,
 			"humidity", p.Humidity,
 			"pressure", p.Pressure,
 			"voltage", p.Voltage,
+			"sequence", p.Sequence,
 			"timestamp", p.Timestamp)
 
 		emitter.Emit(p)
 	}
 }
+
+// decode attributes packets without a device id to the sender address.
+func (s *Service) decode(data []byte, addr net.Addr) (packet.Packet, error) {
+	p := packet.Packet{Device: deviceFromAddr(addr)}
+
+	if err := s.decoder.Decode(data, &p); err != nil {
+		return packet.Packet{}, fmt.Errorf("decode: %w", err)
+	}
+
+	return p, nil
+}
+
+// deviceFromAddr identifies a sensor by the host part of its sender address.
+func deviceFromAddr(addr net.Addr) string {
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+
+	return host
+}
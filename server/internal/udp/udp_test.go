@@ -0,0 +1,152 @@
+package udp //nolint:testpackage
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/capture"
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chanEmitter chan packet.Packet
+
+func (e chanEmitter) Emit(data packet.Packet) {
+	e <- data
+}
+
+func legacyDatagram(values ...float32) []byte {
+	data := make([]byte, 0, 4*len(values))
+	for _, v := range values {
+		data = binary.LittleEndian.AppendUint32(data, math.Float32bits(v))
+	}
+
+	return data
+}
+
+// balconyFrame is the framed datagram of device balcony with sequence 7,
+// 21.5 °C, 40 %, 1000 hPa and 3300 mV.
+const balconyFrame = "5453010762616c636f6e79070000006608a00f0186a0e40cbde3"
+
+func newDecoder(t *testing.T, names ...string) packet.Decoder {
+	t.Helper()
+
+	decoder, err := packet.NewDecoder(names, packet.DecoderOptions{})
+	require.NoError(t, err)
+
+	return decoder
+}
+
+func TestListenDropsMalformedDatagrams(t *testing.T) {
+	quarantine := filepath.Join(t.TempDir(), "quarantine.log")
+	captureFile := filepath.Join(t.TempDir(), "capture.ndjson")
+
+	recorder, err := capture.Open(captureFile)
+	require.NoError(t, err)
+
+	decoder := newDecoder(t, packet.DecoderUDPFrame, packet.DecoderLegacyUDP)
+
+	srv, err := Listen(t.Context(), config.UDPServer{Port: "127.0.0.1:0", Quarantine: quarantine}, decoder, recorder)
+	require.NoError(t, err)
+
+	emitter := make(chanEmitter, 1)
+	done := make(chan error, 1)
+
+	go func() { done <- srv.Listen(t.Context(), emitter) }()
+
+	conn, err := net.Dial("udp4", srv.pc.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte{0x01, 0x02, 0x03})
+	require.NoError(t, err)
+
+	_, err = conn.Write(legacyDatagram(21.5, 40, 100000, 3300))
+	require.NoError(t, err)
+
+	select {
+	case p := <-emitter:
+		assert.InDelta(t, 21.5, p.Temperature, 1e-6)
+		assert.Equal(t, "127.0.0.1", p.Device)
+	case err := <-done:
+		t.Fatalf("listener stopped: %v", err)
+	case <-time.After(time.Second):
+		t.Fatal("no packet received")
+	}
+
+	assert.Equal(t, uint64(1), srv.Malformed())
+	require.NoError(t, srv.Close())
+
+	content, err := os.ReadFile(quarantine)
+	require.NoError(t, err)
+
+	fields := strings.Split(strings.TrimSpace(string(content)), "\t")
+	require.Len(t, fields, 3)
+	assert.Contains(t, fields[1], "127.0.0.1:")
+	assert.Equal(t, "010203", fields[2])
+
+	// both datagrams are recorded and the valid one replays as received
+	require.NoError(t, recorder.Close())
+
+	in, err := os.Open(captureFile)
+	require.NoError(t, err)
+
+	defer in.Close()
+
+	replayed := make(chanEmitter, 1)
+
+	result, err := capture.Replay(t.Context(), in, capture.Decoders{capture.TransportUDP: decoder}, 0, replayed)
+	require.NoError(t, err)
+	assert.Equal(t, capture.Result{Frames: 2, Emitted: 1, Unrecognized: 1}, result)
+
+	p := <-replayed
+	assert.InDelta(t, 21.5, p.Temperature, 1e-6)
+	assert.Equal(t, "127.0.0.1", p.Device)
+}
+
+func TestListenFramedWithoutLegacy(t *testing.T) {
+	srv, err := Listen(t.Context(), config.UDPServer{Port: "127.0.0.1:0"}, newDecoder(t, packet.DecoderUDPFrame), nil)
+	require.NoError(t, err)
+
+	defer srv.Close()
+
+	emitter := make(chanEmitter, 1)
+
+	go srv.Listen(t.Context(), emitter) //nolint:errcheck
+
+	conn, err := net.Dial("udp4", srv.pc.LocalAddr().String())
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write(legacyDatagram(21.5, 40, 100000, 3300))
+	require.NoError(t, err)
+
+	frame, err := hex.DecodeString(balconyFrame)
+	require.NoError(t, err)
+
+	_, err = conn.Write(frame)
+	require.NoError(t, err)
+
+	select {
+	case p := <-emitter:
+		assert.Equal(t, "balcony", p.Device)
+		assert.Equal(t, uint32(7), p.Sequence)
+		assert.InDelta(t, 21.5, p.Temperature, 1e-6)
+	case <-time.After(time.Second):
+		t.Fatal("no packet received")
+	}
+
+	assert.Equal(t, uint64(1), srv.Malformed())
+}
@@ -0,0 +1,262 @@
+package web
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/dataset"
+	"temperature-sensor/internal/ingest"
+	"temperature-sensor/internal/packet"
+)
+
+const apiPrefix = "/api/v1/"
+
+var (
+	errUnknownDevice     = errors.New("unknown device")
+	errUnknownMetric     = errors.New("unknown metric")
+	errDeviceRequired    = errors.New("device is required when several devices are known")
+	errInvalidResolution = errors.New("invalid resolution")
+	errInvalidRange      = errors.New("from must be before to")
+	errNotFound          = errors.New("not found")
+	errMethodNotAllowed  = errors.New("method not allowed")
+	errTokenDisabled     = errors.New("disabled, start with -http-import-token")
+	errInvalidToken      = errors.New("missing or invalid bearer token")
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type deviceInfo struct {
+	ID       string        `json:"id"`
+	LastSeen time.Time     `json:"last_seen"`
+	Current  packet.Packet `json:"current"`
+	// Link is known for devices that send a sequence.
+	Link *ingest.Link `json:"link,omitempty"`
+}
+
+type seriesResponse struct {
+	Device string          `json:"device"`
+	From   time.Time       `json:"from,omitzero"`
+	To     time.Time       `json:"to,omitzero"`
+	Series *dataset.Series `json:"series"`
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.ErrorContext(r.Context(), "failed to encode JSON response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	writeJSON(w, r, status, apiError{Error: err.Error()})
+}
+
+// apiMethod rejects every other method with a JSON error.
+func apiMethod(method string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeError(w, r, http.StatusMethodNotAllowed, errMethodNotAllowed)
+
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// requireToken lets requests with the bearer token through, every request
+// is forbidden without a token.
+func requireToken(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			writeError(w, r, http.StatusForbidden, errTokenDisabled)
+
+			return
+		}
+
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, r, http.StatusUnauthorized, errInvalidToken)
+
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+func apiGet(handler http.HandlerFunc) http.HandlerFunc {
+	return apiMethod(http.MethodGet, handler)
+}
+
+func apiNotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, fmt.Errorf("%w: %s", errNotFound, r.URL.Path))
+}
+
+// currentHandler returns the latest packet of one device, or of every device
+// keyed by id when no device is given.
+func currentHandler(s stats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id := r.URL.Query().Get("device"); id != "" {
+			current, ok := s.Current(id)
+			if !ok {
+				writeError(w, r, http.StatusNotFound, fmt.Errorf("%w: %s", errUnknownDevice, id))
+
+				return
+			}
+
+			writeJSON(w, r, http.StatusOK, current)
+
+			return
+		}
+
+		devices := s.Devices()
+		response := make(map[string]packet.Packet, len(devices))
+
+		for _, id := range devices {
+			if current, ok := s.Current(id); ok {
+				response[id] = current
+			}
+		}
+
+		writeJSON(w, r, http.StatusOK, response)
+	}
+}
+
+func devicesHandler(s stats, l links) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		devices := s.Devices()
+		response := make([]deviceInfo, 0, len(devices))
+
+		for _, id := range devices {
+			current, ok := s.Current(id)
+			if !ok {
+				continue
+			}
+
+			info := deviceInfo{
+				ID:       id,
+				LastSeen: current.Timestamp,
+				Current:  current,
+			}
+
+			if link, ok := l.Link(id); ok {
+				info.Link = &link
+			}
+
+			response = append(response, info)
+		}
+
+		writeJSON(w, r, http.StatusOK, response)
+	}
+}
+
+func seriesHandler(s stats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query, metric, status, err := parseSeriesQuery(r, s)
+		if err != nil {
+			writeError(w, r, status, err)
+
+			return
+		}
+
+		series := s.Series(query)
+
+		if metric != "" {
+			series = series.Only(metric)
+		}
+
+		writeJSON(w, r, http.StatusOK, seriesResponse{
+			Device: query.Device,
+			From:   query.From,
+			To:     query.To,
+			Series: series,
+		})
+	}
+}
+
+func parseSeriesQuery(r *http.Request, s stats) (dataset.Query, string, int, error) {
+	values := r.URL.Query()
+
+	device, status, err := resolveDevice(values.Get("device"), s)
+	if err != nil {
+		return dataset.Query{}, "", status, err
+	}
+
+	metric := values.Get("metric")
+	if metric != "" && !slices.Contains(s.Metrics(), metric) {
+		return dataset.Query{}, "", http.StatusBadRequest, fmt.Errorf("%w: %s", errUnknownMetric, metric)
+	}
+
+	resolution, ok := dataset.ParseResolution(values.Get("resolution"))
+	if !ok {
+		return dataset.Query{}, "", http.StatusBadRequest,
+			fmt.Errorf("%w: %s", errInvalidResolution, values.Get("resolution"))
+	}
+
+	from, err := config.ParseTime(values.Get("from"))
+	if err != nil {
+		return dataset.Query{}, "", http.StatusBadRequest, fmt.Errorf("from: %w", err)
+	}
+
+	to, err := config.ParseTime(values.Get("to"))
+	if err != nil {
+		return dataset.Query{}, "", http.StatusBadRequest, fmt.Errorf("to: %w", err)
+	}
+
+	if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+		return dataset.Query{}, "", http.StatusBadRequest, errInvalidRange
+	}
+
+	query := dataset.Query{
+		Device:     device,
+		From:       from,
+		To:         to,
+		Resolution: resolution,
+	}
+
+	return query, metric, http.StatusOK, nil
+}
+
+// resolveDevice defaults to the only known device.
+func resolveDevice(id string, s stats) (string, int, error) {
+	devices := s.Devices()
+
+	if id == "" {
+		if len(devices) != 1 {
+			return "", http.StatusBadRequest, errDeviceRequired
+		}
+
+		return devices[0], http.StatusOK, nil
+	}
+
+	if !slices.Contains(devices, id) {
+		return "", http.StatusNotFound, fmt.Errorf("%w: %s", errUnknownDevice, id)
+	}
+
+	return id, http.StatusOK, nil
+}
+
+func registerAPI(mux *http.ServeMux, s stats, l links, importToken string) {
+	mux.Handle(apiPrefix+"current", apiGet(currentHandler(s)))
+	mux.Handle(apiPrefix+"devices", apiGet(devicesHandler(s, l)))
+	mux.Handle(apiPrefix+"series", apiGet(seriesHandler(s)))
+	mux.Handle(apiPrefix+"export", apiGet(exportHandler(s)))
+	mux.Handle(apiPrefix+"import", apiMethod(http.MethodPost, requireToken(importToken, importHandler(s))))
+	mux.HandleFunc("/api/", apiNotFoundHandler)
+}
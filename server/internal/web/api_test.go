@@ -0,0 +1,293 @@
+package web //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/dataset"
+	"temperature-sensor/internal/ingest"
+	"temperature-sensor/internal/packet"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStats(t *testing.T, now time.Time, devices ...string) *dataset.Stats {
+	t.Helper()
+
+	periods, err := config.ParsePeriods("morning=06:00@08:00,day=14:00@14:00,evening=19:00@19:00")
+	require.NoError(t, err)
+
+	storage, err := dataset.NewFileStorage(t.TempDir())
+	require.NoError(t, err)
+
+	t.Cleanup(func() { storage.Close() })
+
+	stats := dataset.NewStats(config.Dataset{
+		Location:            time.UTC,
+		Periods:             periods,
+		RawRetention:        48 * time.Hour,
+		FiveMinuteRetention: 7 * 24 * time.Hour,
+		HourRetention:       90 * 24 * time.Hour,
+		DayRetention:        365 * 24 * time.Hour,
+	}, storage)
+
+	// one reading per minute during the last hour
+	for i := range 60 {
+		for j, id := range devices {
+			err := stats.Push(packet.Packet{
+				Device:      id,
+				Timestamp:   now.Add(time.Duration(i-60) * time.Minute),
+				Temperature: float32(20 + j),
+				Humidity:    50,
+			})
+			require.NoError(t, err)
+		}
+	}
+
+	return stats
+}
+
+type fakeLinks map[string]ingest.Link
+
+func (f fakeLinks) Link(device string) (ingest.Link, bool) {
+	link, ok := f[device]
+
+	return link, ok
+}
+
+func (f fakeLinks) Links() map[string]ingest.Link {
+	return f
+}
+
+const testImportToken = "secret"
+
+func testLinks() fakeLinks {
+	return fakeLinks{"balcony": {Expected: 10, Received: 9, Lost: 1, LastSequence: 10, LossRate: 0.1}}
+}
+
+func serveAPI(t *testing.T, s stats, method, target string) (*httptest.ResponseRecorder, map[string]any) {
+	t.Helper()
+
+	mux := http.NewServeMux()
+	registerAPI(mux, s, testLinks(), testImportToken)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), method, target, nil))
+
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var body map[string]any
+	if rec.Body.Len() > 0 && rec.Body.Bytes()[0] == '{' {
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+	}
+
+	return rec, body
+}
+
+func TestAPICurrent(t *testing.T) {
+	now := time.Now()
+	stats := newTestStats(t, now, "balcony", "bedroom")
+
+	rec, body := serveAPI(t, stats, http.MethodGet, "/api/v1/current")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Len(t, body, 2)
+	assert.Contains(t, body, "balcony")
+
+	rec, body = serveAPI(t, stats, http.MethodGet, "/api/v1/current?device=bedroom")
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "bedroom", body["device"])
+	assert.InEpsilon(t, 21.0, body["temperature"], 1e-6)
+
+	rec, body = serveAPI(t, stats, http.MethodGet, "/api/v1/current?device=kitchen")
+	require.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "unknown device: kitchen", body["error"])
+}
+
+func TestAPIDevices(t *testing.T) {
+	stats := newTestStats(t, time.Now(), "bedroom", "balcony")
+
+	rec, _ := serveAPI(t, stats, http.MethodGet, "/api/v1/devices")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var devices []deviceInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &devices))
+	require.Len(t, devices, 2)
+	assert.Equal(t, "balcony", devices[0].ID)
+	assert.Equal(t, devices[0].Current.Timestamp, devices[0].LastSeen)
+
+	require.NotNil(t, devices[0].Link)
+	assert.InDelta(t, 0.1, devices[0].Link.LossRate, 1e-9)
+	assert.Nil(t, devices[1].Link)
+}
+
+func TestAPISeries(t *testing.T) {
+	now := time.Now()
+	stats := newTestStats(t, now, "balcony")
+
+	// the only device is the default one
+	rec, body := serveAPI(t, stats, http.MethodGet, "/api/v1/series?metric=temperature&from="+
+		strconv.FormatInt(now.Add(-2*time.Hour).UnixMilli(), 10))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "balcony", body["device"])
+
+	series, ok := body["series"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "raw", series["resolution"])
+	assert.Len(t, series["temperature"], 60)
+	assert.NotContains(t, series, "humidity")
+
+	rec, body = serveAPI(t, stats, http.MethodGet, "/api/v1/series?device=balcony&resolution=1h&from="+
+		now.Add(-3*time.Hour).Format(time.RFC3339))
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	series, ok = body["series"].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "1h", series["resolution"])
+	assert.Contains(t, series, "humidity")
+
+	rec, body = serveAPI(t, stats, http.MethodGet, "/api/v1/series?resolution=period")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	series, ok = body["series"].(map[string]any)
+	require.True(t, ok)
+	assert.Contains(t, series, "extremes")
+}
+
+func TestAPISeriesErrors(t *testing.T) {
+	stats := newTestStats(t, time.Now(), "balcony", "bedroom")
+
+	tests := []struct {
+		target string
+		status int
+	}{
+		{"/api/v1/series", http.StatusBadRequest},
+		{"/api/v1/series?device=kitchen", http.StatusNotFound},
+		{"/api/v1/series?device=balcony&metric=wind", http.StatusBadRequest},
+		{"/api/v1/series?device=balcony&resolution=2h", http.StatusBadRequest},
+		{"/api/v1/series?device=balcony&from=yesterday", http.StatusBadRequest},
+		{"/api/v1/series?device=balcony&from=2000&to=1000", http.StatusBadRequest},
+		{"/api/v1/unknown", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		rec, body := serveAPI(t, stats, http.MethodGet, test.target)
+		assert.Equal(t, test.status, rec.Code, test.target)
+		assert.NotEmpty(t, body["error"], test.target)
+	}
+
+	rec, body := serveAPI(t, stats, http.MethodPost, "/api/v1/devices")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodGet, rec.Header().Get("Allow"))
+	assert.NotEmpty(t, body["error"])
+}
+
+func TestAPIExport(t *testing.T) {
+	now := time.Now()
+	stats := newTestStats(t, now, "balcony", "bedroom")
+
+	mux := http.NewServeMux()
+	registerAPI(mux, stats, testLinks(), testImportToken)
+
+	rec := httptest.NewRecorder()
+	target := "/api/v1/export?device=bedroom&temperature_unit=f&from=" + strconv.FormatInt(now.Add(-30*time.Minute).UnixMilli(), 10)
+	mux.ServeHTTP(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, target, nil))
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Contains(t, rec.Header().Get("Content-Disposition"), "readings.csv")
+
+	lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+	require.Len(t, lines, 31)
+	assert.Equal(t, "timestamp,device,temperature_f,humidity_percent,pressure_mmhg,voltage_mv", lines[0])
+	assert.Contains(t, lines[1], ",bedroom,69.80,50.00,")
+
+	rec, body := serveAPI(t, stats, http.MethodGet, "/api/v1/export?format=xml")
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.NotEmpty(t, body["error"])
+}
+
+func TestAPIImport(t *testing.T) {
+	now := time.Now().Truncate(time.Millisecond)
+	stats := newTestStats(t, now, "balcony")
+
+	mux := http.NewServeMux()
+	registerAPI(mux, stats, testLinks(), testImportToken)
+
+	body := `{"timestamp": ` + strconv.FormatInt(now.Add(-2*time.Hour).UnixMilli(), 10) + `, "temperature_f": 50}
+{"timestamp": ` + strconv.FormatInt(now.Add(-time.Minute).UnixMilli(), 10) + `, "temperature_f": 50}
+`
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/v1/import?format=ndjson&device=balcony",
+		strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testImportToken)
+	mux.ServeHTTP(rec, req)
+
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"imported": 1, "duplicates": 1, "expired": 0}`, rec.Body.String())
+
+	series := stats.Series(dataset.Query{Device: "balcony", Resolution: dataset.ResolutionRaw})
+	assert.Len(t, series.Metrics[dataset.MetricTemperature], 61)
+
+	rec, resp := serveAPI(t, stats, http.MethodGet, "/api/v1/import")
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, http.MethodPost, rec.Header().Get("Allow"))
+	assert.NotEmpty(t, resp["error"])
+
+	// the token is checked first
+	rec, resp = serveAPI(t, stats, http.MethodPost, "/api/v1/import?format=xml")
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "Bearer", rec.Header().Get("WWW-Authenticate"))
+	assert.NotEmpty(t, resp["error"])
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/v1/import?format=xml", nil)
+	req.Header.Set("Authorization", "Bearer "+testImportToken)
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	// imports are off without a token
+	disabled := http.NewServeMux()
+	registerAPI(disabled, stats, testLinks(), "")
+
+	rec = httptest.NewRecorder()
+	req = httptest.NewRequestWithContext(t.Context(), http.MethodPost, "/api/v1/import", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer ")
+	disabled.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestHealth(t *testing.T) {
+	connected := true
+	checks := map[string]HealthCheck{
+		"mqtt": func() (any, bool) { return map[string]bool{"connected": connected}, connected },
+	}
+
+	serve := func() (*httptest.ResponseRecorder, healthResponse) {
+		rec := httptest.NewRecorder()
+		healthHandler(checks)(rec, httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/healthz", nil))
+
+		var body healthResponse
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &body))
+
+		return rec, body
+	}
+
+	rec, body := serve()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, healthOK, body.Status)
+	assert.Equal(t, map[string]any{"connected": true}, body.Checks["mqtt"])
+
+	connected = false
+
+	rec, body = serve()
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.Equal(t, healthUnavailable, body.Status)
+}
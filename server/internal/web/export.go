@@ -0,0 +1,125 @@
+package web
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"temperature-sensor/internal/archive"
+	"temperature-sensor/internal/config"
+	"temperature-sensor/internal/packet"
+)
+
+// maxImportSize limits an import request body.
+const maxImportSize = 64 << 20
+
+func queryDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+
+	return value
+}
+
+func parseExportQuery(r *http.Request) (archive.Format, archive.Units, archive.Filter, error) {
+	values := r.URL.Query()
+
+	format, err := archive.ParseFormat(queryDefault(values.Get("format"), string(archive.FormatCSV)))
+	if err != nil {
+		return "", archive.Units{}, archive.Filter{}, err
+	}
+
+	units, err := archive.ParseUnits(
+		queryDefault(values.Get("pressure_unit"), string(archive.PressureMmHg)),
+		queryDefault(values.Get("temperature_unit"), string(archive.TemperatureCelsius)),
+	)
+	if err != nil {
+		return "", archive.Units{}, archive.Filter{}, err
+	}
+
+	from, err := config.ParseTime(values.Get("from"))
+	if err != nil {
+		return "", archive.Units{}, archive.Filter{}, fmt.Errorf("from: %w", err)
+	}
+
+	to, err := config.ParseTime(values.Get("to"))
+	if err != nil {
+		return "", archive.Units{}, archive.Filter{}, fmt.Errorf("to: %w", err)
+	}
+
+	filter := archive.Filter{
+		Device: values.Get("device"),
+		From:   from,
+		To:     to,
+	}
+
+	return format, units, filter, nil
+}
+
+// exportHandler streams stored readings as CSV or NDJSON.
+func exportHandler(s stats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format, units, filter, err := parseExportQuery(r)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+
+			return
+		}
+
+		w.Header().Set("Content-Type", format.ContentType())
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="readings.%s"`, format))
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		count, err := archive.Export(archive.NewWriter(w, format, units), s.Readings, filter)
+		if err != nil {
+			// the status line is gone already, the client sees a truncated body
+			slog.ErrorContext(r.Context(), "failed to export readings", "error", err, "count", count)
+
+			return
+		}
+
+		slog.DebugContext(r.Context(), "exported readings", "count", count, "format", format)
+	}
+}
+
+// importHandler reads CSV or NDJSON from the request body, readings without a
+// device column belong to the device parameter or the default device.
+func importHandler(s stats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		values := r.URL.Query()
+
+		format, err := archive.ParseFormat(queryDefault(values.Get("format"), string(archive.FormatCSV)))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, err)
+
+			return
+		}
+
+		device := values.Get("device")
+		body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+		result, err := s.Import(time.Now(), func(fn func(data packet.Packet) error) error {
+			return archive.Read(body, format, device, fn)
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				status = http.StatusRequestEntityTooLarge
+			}
+
+			slog.WarnContext(r.Context(), "failed to import readings", "error", err, "imported", result.Imported)
+			writeError(w, r, status, err)
+
+			return
+		}
+
+		slog.InfoContext(r.Context(), "imported readings", "imported", result.Imported,
+			"duplicates", result.Duplicates, "expired", result.Expired)
+
+		writeJSON(w, r, http.StatusOK, result)
+	}
+}
@@ -0,0 +1,41 @@
+package web
+
+import (
+	"maps"
+	"net/http"
+	"slices"
+)
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+// HealthCheck returns the state of a component and whether it works.
+type HealthCheck func() (state any, healthy bool)
+
+type healthResponse struct {
+	Status string         `json:"status"`
+	Checks map[string]any `json:"checks,omitempty"`
+}
+
+// healthHandler answers 503 while any check fails, for supervisors and
+// monitoring.
+func healthHandler(checks map[string]HealthCheck) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := healthResponse{Status: healthOK, Checks: make(map[string]any, len(checks))}
+		status := http.StatusOK
+
+		for _, name := range slices.Sorted(maps.Keys(checks)) {
+			state, healthy := checks[name]()
+			response.Checks[name] = state
+
+			if !healthy {
+				response.Status = healthUnavailable
+				status = http.StatusServiceUnavailable
+			}
+		}
+
+		writeJSON(w, r, status, response)
+	}
+}
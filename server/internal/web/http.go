@@ -14,7 +14,9 @@ import (
 	"text/template"
 	"time"
 
+	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/dataset"
+	"temperature-sensor/internal/ingest"
 	"temperature-sensor/internal/packet"
 )
 
@@ -24,6 +26,30 @@ const (
 
 type stats interface {
 	EventResponse() *dataset.EventResponse
+	Devices() []string
+	Metrics() []string
+	Current(id string) (packet.Packet, bool)
+	Series(q dataset.Query) *dataset.Series
+	Readings(fn func(data packet.Packet)) error
+	Import(now time.Time, read func(fn func(data packet.Packet) error) error) (dataset.ImportResult, error)
+}
+
+type links interface {
+	Link(device string) (ingest.Link, bool)
+	Links() map[string]ingest.Link
+}
+
+// eventResponse adds the link quality of every device to the stats.
+type eventResponse struct {
+	*dataset.EventResponse
+	Links map[string]ingest.Link `json:"links"`
+}
+
+func newEventResponse(s stats, l links) eventResponse {
+	return eventResponse{
+		EventResponse: s.EventResponse(),
+		Links:         l.Links(),
+	}
 }
 
 type eventEmitter interface {
@@ -49,7 +75,7 @@ func newServer(ctx context.Context, addr string) *http.Server {
 	}
 }
 
-func sendResponse(w http.ResponseWriter, response *dataset.EventResponse) error {
+func sendResponse(w http.ResponseWriter, response eventResponse) error {
 	flusher, ok := w.(http.Flusher)
 	if !ok {
 		return errStreamUnsupported
@@ -74,7 +100,7 @@ func sendResponse(w http.ResponseWriter, response *dataset.EventResponse) error
 	return nil
 }
 
-func subscribeHandler(emitter eventEmitter, s stats) http.HandlerFunc {
+func subscribeHandler(emitter eventEmitter, s stats, l links) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Expose-Headers", "Content-Type")
@@ -88,7 +114,7 @@ func subscribeHandler(emitter eventEmitter, s stats) http.HandlerFunc {
 
 		ctx := r.Context()
 
-		if err := sendResponse(w, s.EventResponse()); err != nil {
+		if err := sendResponse(w, newEventResponse(s, l)); err != nil {
 			slog.ErrorContext(ctx, "failed to send initial response", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 
@@ -98,7 +124,7 @@ func subscribeHandler(emitter eventEmitter, s stats) http.HandlerFunc {
 		for {
 			select {
 			case <-ch:
-				if err := sendResponse(w, s.EventResponse()); err != nil {
+				if err := sendResponse(w, newEventResponse(s, l)); err != nil {
 					slog.ErrorContext(ctx, "failed to send response", "error", err)
 					http.Error(w, err.Error(), http.StatusInternalServerError)
 
@@ -117,7 +143,7 @@ func fileExists(fs embed.FS, path string) bool {
 	return !errors.Is(err, iofs.ErrNotExist)
 }
 
-func mainHandler(fileServer http.Handler, tmpl *template.Template, s stats) http.HandlerFunc {
+func mainHandler(fileServer http.Handler, tmpl *template.Template, s stats, l links) http.HandlerFunc {
 	etagCache := make(map[string]string)
 	version := time.Now().Unix()
 
@@ -154,7 +180,7 @@ func mainHandler(fileServer http.Handler, tmpl *template.Template, s stats) http
 			return
 		}
 
-		jsonData, err := json.Marshal(s.EventResponse())
+		jsonData, err := json.Marshal(newEventResponse(s, l))
 		if err != nil {
 			slog.ErrorContext(ctx, "failed to marshal JSON data", "error", err)
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -178,7 +204,14 @@ func mainHandler(fileServer http.Handler, tmpl *template.Template, s stats) http
 	}
 }
 
-func New(ctx context.Context, addr string, emitter eventEmitter, s stats) (*http.Server, error) {
+func New(
+	ctx context.Context,
+	cfg config.HTTPServer,
+	emitter eventEmitter,
+	s stats,
+	l links,
+	checks map[string]HealthCheck,
+) (*http.Server, error) {
 	fs := http.FileServer(http.FS(publicFiles))
 
 	tmpl, err := template.ParseFS(templateFiles, "templates/index.html")
@@ -188,11 +221,13 @@ func New(ctx context.Context, addr string, emitter eventEmitter, s stats) (*http
 
 	mux := http.NewServeMux()
 
-	srv := newServer(ctx, addr)
+	srv := newServer(ctx, cfg.Addr)
 	srv.Handler = mux
 
-	mux.Handle("/", mainHandler(fs, tmpl, s))
-	mux.Handle("/subscribe", subscribeHandler(emitter, s))
+	mux.Handle("/", mainHandler(fs, tmpl, s, l))
+	mux.Handle("/subscribe", subscribeHandler(emitter, s, l))
+	mux.Handle("/healthz", apiGet(healthHandler(checks)))
+	registerAPI(mux, s, l, cfg.ImportToken)
 
 	return srv, nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -10,8 +11,10 @@ import (
 	"syscall"
 	"time"
 
+	"temperature-sensor/internal/capture"
 	"temperature-sensor/internal/config"
 	"temperature-sensor/internal/dataset"
+	"temperature-sensor/internal/ingest"
 	"temperature-sensor/internal/mqtt"
 	"temperature-sensor/internal/packet"
 	"temperature-sensor/internal/serial"
@@ -27,11 +30,21 @@ var (
 )
 
 const (
-	shutdownTimeout = 2 * time.Second
-	clearInterval   = 1 * 24 * time.Hour
+	shutdownTimeout     = 2 * time.Second
+	clearInterval       = 1 * 24 * time.Hour
+	counterSaveInterval = 1 * time.Minute
 )
 
 func main() { //nolint:funlen
+	if ok, err := runCommand(os.Args[1:]); ok {
+		if err != nil {
+			slog.Error("command failed", "command", os.Args[1], "error", err)
+			os.Exit(1)
+		}
+
+		return
+	}
+
 	cfg := config.FromFlags()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
@@ -63,8 +76,31 @@ func main() { //nolint:funlen
 		err           error
 	)
 
+	verifier, err := openVerifier(cfg.Auth, cfg.Storage.DataDir)
+	if err != nil {
+		slog.Error("failed to load auth keys", "error", err)
+
+		return
+	}
+
+	recorder, err := capture.Open(cfg.Capture.File)
+	if err != nil {
+		slog.Error("failed to open capture", "error", err)
+
+		return
+	}
+
+	defer recorder.Close()
+
 	if cfg.UDPServer.Enable {
-		serverUDP, err = udp.Listen(ctx, cfg.UDPServer.Port)
+		udpDecoder, decoderErr := packet.NewDecoder(cfg.UDPServer.Decoders, packet.DecoderOptions{Verifier: verifier})
+		if decoderErr != nil {
+			slog.Error("invalid UDP decoders", "error", decoderErr)
+
+			return
+		}
+
+		serverUDP, err = udp.Listen(ctx, cfg.UDPServer, udpDecoder, recorder)
 		if err != nil {
 			slog.Error("failed to start UDP server", "error", err)
 
@@ -75,19 +111,92 @@ func main() { //nolint:funlen
 	}
 
 	if cfg.Serial.Enable {
-		serialService = serial.New(cfg.Serial.PortName, cfg.Serial.BaudRate)
+		serialDecoder, decoderErr := packet.NewDecoder(cfg.Serial.Decoders, packet.DecoderOptions{
+			Verifier: verifier,
+			Tag:      cfg.Serial.Tag,
+			Names:    cfg.Serial.Names,
+		})
+		if decoderErr != nil {
+			slog.Error("invalid serial decoders", "error", decoderErr)
+
+			return
+		}
+
+		serialService, err = serial.New(cfg.Serial, serialDecoder, recorder)
+		if err != nil {
+			slog.Error("invalid serial config", "error", err)
+
+			return
+		}
 	}
 
 	emitter := packet.NewEventEmitter()
 	defer emitter.Close()
 
+	// sources emit into the ingest pipeline, which ends at the emitter
+	dedup := ingest.NewDeduplicator(emitter, cfg.Ingest.DedupWindow)
+	tracker := ingest.NewLossTracker(dedup)
+
 	if cfg.MQTT.Enable {
-		mqttService = mqtt.New(cfg.MQTT, emitter)
+		subscriptions, subErr := mqttSubscriptions(cfg.MQTT.Subscriptions, verifier)
+		if subErr != nil {
+			slog.Error("invalid MQTT subscription", "error", subErr)
+
+			return
+		}
+
+		mqttService, err = mqtt.New(cfg.MQTT, tracker, subscriptions, recorder)
+		if err != nil {
+			slog.Error("invalid MQTT config", "error", err)
+
+			return
+		}
+	}
+
+	storage, err := openStorage(cfg.Storage)
+	if err != nil {
+		slog.Error("failed to open storage", "error", err)
+
+		return
+	}
+
+	defer storage.Close()
+
+	stats := dataset.NewStats(cfg.Dataset, storage)
+
+	if err := stats.Restore(time.Now()); err != nil {
+		slog.Error("failed to restore stats", "error", err)
+
+		return
+	}
+
+	checks := map[string]web.HealthCheck{
+		"ingest": func() (any, bool) {
+			return map[string]uint64{"duplicates": dedup.Dropped()}, true
+		},
+	}
+
+	if verifier != nil {
+		checks["auth"] = func() (any, bool) {
+			return map[string]uint64{"rejected": verifier.Rejected()}, true
+		}
+	}
+
+	if cfg.UDPServer.Enable {
+		checks["udp"] = func() (any, bool) {
+			return map[string]uint64{"malformed": serverUDP.Malformed()}, true
+		}
 	}
 
-	stats := dataset.NewStats()
+	if cfg.MQTT.Enable {
+		checks["mqtt"] = func() (any, bool) {
+			state := mqttService.State()
+
+			return state, state.Connected
+		}
+	}
 
-	serverHTTP, err := web.New(ctx, cfg.HTTPServer.Addr, emitter, stats)
+	serverHTTP, err := web.New(ctx, cfg.HTTPServer, emitter, stats, tracker, checks)
 	if err != nil {
 		slog.Error("failed to create HTTP server", "error", err)
 
@@ -98,13 +207,13 @@ func main() { //nolint:funlen
 
 	if cfg.UDPServer.Enable {
 		g.Go(func() error {
-			return serverUDP.Listen(gCtx, emitter)
+			return serverUDP.Listen(gCtx, tracker)
 		})
 	}
 
 	if cfg.Serial.Enable {
 		g.Go(func() error {
-			return serialService.Run(gCtx, cfg.Serial.Tag, emitter)
+			return serialService.Run(gCtx, cfg.Serial.Tag, tracker)
 		})
 	}
 
@@ -118,6 +227,14 @@ func main() { //nolint:funlen
 
 			return mqttService.Close()
 		})
+
+		if cfg.MQTT.Publish.Topic != "" {
+			seen := lastSeen(stats)
+
+			g.Go(func() error {
+				return mqttService.Publish(gCtx, emitter, seen)
+			})
+		}
 	}
 
 	g.Go(func() error {
@@ -128,6 +245,12 @@ func main() { //nolint:funlen
 		return stats.Clear(gCtx, clearInterval)
 	})
 
+	if verifier != nil {
+		g.Go(func() error {
+			return verifier.SaveEvery(gCtx, counterSaveInterval)
+		})
+	}
+
 	g.Go(func() error {
 		slog.Info("starting HTTP server", "address", serverHTTP.Addr)
 
@@ -161,21 +284,50 @@ func logStartupConfig(cfg config.Config) {
 		cfg.Serial.Enable,
 		"mqtt_enabled",
 		cfg.MQTT.Enable,
+		"data_dir",
+		cfg.Storage.DataDir,
+		"auth_keys",
+		cfg.Auth.KeysFile,
+		"dedup_window",
+		cfg.Ingest.DedupWindow,
+		"capture",
+		cfg.Capture.File,
+	)
+
+	slog.Info(
+		"dataset config",
+		"timezone",
+		cfg.Dataset.Location,
+		"day_periods",
+		cfg.Dataset.Periods,
+		"raw_retention",
+		cfg.Dataset.RawRetention,
+		"5m_retention",
+		cfg.Dataset.FiveMinuteRetention,
+		"1h_retention",
+		cfg.Dataset.HourRetention,
+		"1d_retention",
+		cfg.Dataset.DayRetention,
 	)
 
 	if cfg.UDPServer.Enable {
-		slog.Info("udp config", "port", cfg.UDPServer.Port)
+		slog.Info("udp config", "port", cfg.UDPServer.Port, "quarantine", cfg.UDPServer.Quarantine,
+			"decoders", cfg.UDPServer.Decoders)
 	}
 
 	if cfg.Serial.Enable {
 		slog.Info(
 			"serial config",
-			"port",
-			cfg.Serial.PortName,
+			"ports",
+			cfg.Serial.Ports,
 			"baud",
 			cfg.Serial.BaudRate,
 			"tag",
 			cfg.Serial.Tag,
+			"decoders",
+			cfg.Serial.Decoders,
+			"names",
+			cfg.Serial.Names,
 		)
 	}
 
@@ -184,12 +336,100 @@ func logStartupConfig(cfg config.Config) {
 			"mqtt config",
 			"broker",
 			cfg.MQTT.Broker,
-			"topic",
-			cfg.MQTT.Topic,
 			"client_id",
 			cfg.MQTT.ClientID,
 			"username",
 			cfg.MQTT.Username,
+			"tls_ca",
+			cfg.MQTT.TLS.CAFile,
+			"tls_cert",
+			cfg.MQTT.TLS.CertFile,
+			"tls_insecure",
+			cfg.MQTT.TLS.InsecureSkipVerify,
 		)
+
+		if cfg.MQTT.Publish.Topic != "" {
+			slog.Info("mqtt publish", "topic", cfg.MQTT.Publish.Topic, "qos", cfg.MQTT.Publish.QoS,
+				"retain", cfg.MQTT.Publish.Retain, "discovery", cfg.MQTT.Discovery.Enable)
+		}
+
+		for _, sub := range cfg.MQTT.Subscriptions {
+			slog.Info("mqtt subscription", "subscription", sub.String())
+		}
+	}
+}
+
+func openStorage(cfg config.Storage) (dataset.Storage, error) {
+	if cfg.DataDir == "" {
+		return dataset.NewMemoryStorage(), nil
+	}
+
+	return dataset.NewFileStorage(cfg.DataDir)
+}
+
+func mqttSubscriptions(subs []config.Subscription, verifier *packet.Verifier) ([]mqtt.Subscription, error) {
+	subscriptions := make([]mqtt.Subscription, 0, len(subs))
+
+	for _, sub := range subs {
+		fields, err := packet.ParseJSONFields(sub.JSONFields)
+		if err != nil {
+			return nil, fmt.Errorf("%s: json fields: %w", sub.Topic, err)
+		}
+
+		decoder, err := packet.NewDecoder(sub.Decoders, packet.DecoderOptions{
+			Verifier:   verifier,
+			JSONFields: fields,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", sub.Topic, err)
+		}
+
+		subscriptions = append(subscriptions, mqtt.Subscription{
+			Topic:         sub.Topic,
+			QoS:           sub.QoS,
+			DeviceSegment: sub.DeviceSegment,
+			Decoder:       decoder,
+		})
+	}
+
+	return subscriptions, nil
+}
+
+// lastSeen returns when every device restored by stats reported last.
+func lastSeen(stats *dataset.Stats) map[string]time.Time {
+	devices := stats.Devices()
+	seen := make(map[string]time.Time, len(devices))
+
+	for _, id := range devices {
+		if data, ok := stats.Current(id); ok {
+			seen[id] = data.Timestamp
+		}
+	}
+
+	return seen
+}
+
+// openVerifier returns nil, accepting unauthenticated packets, without keys.
+// Counters are kept in dataDir when it is set.
+func openVerifier(cfg config.Auth, dataDir string) (*packet.Verifier, error) {
+	if cfg.KeysFile == "" {
+		return nil, nil //nolint:nilnil
+	}
+
+	keys, err := config.LoadKeys(cfg.KeysFile)
+	if err != nil {
+		return nil, err
 	}
+
+	slog.Info("packet authentication enabled", "devices", len(keys))
+
+	verifier := packet.NewVerifier(keys)
+
+	if dataDir != "" {
+		if err := verifier.Persist(packet.NewCounterFile(dataDir)); err != nil {
+			return nil, err
+		}
+	}
+
+	return verifier, nil
 }